@@ -15,6 +15,12 @@
 // of these operation signal to block because we know that we have to receive this at the end of
 // the day.
 
+// Logging every result is fine while we watch, but the caller usually wants one answer: did all of
+// the inserts work, and if not, which ones failed? Each Goroutine adds its errors into a Collector
+// from our errors package. It is safe to use from all of them at once. Once everybody reported
+// back, Err gives us a single error value that holds all of the failures. errors.Is and errors.As
+// look at every one of them, so we can still ask about the kind of failure.
+
 package main
 
 import (
@@ -22,8 +28,36 @@ import (
 	"log"
 	"math/rand"
 	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+// Set of error variables the database can return.
+var (
+	// ErrDeadlock is returned when the insert lost a race with another one. It can be tried again.
+	ErrDeadlock = errors.New("deadlock detected")
+
+	// ErrConstraint is returned when the value breaks a constraint of the table.
+	ErrConstraint = errors.New("constraint violated")
 )
 
+// InsertError tells which insert failed and why.
+type InsertError struct {
+	Table string
+	ID    int
+	Err   error
+}
+
+// InsertError implements the error interface.
+func (e *InsertError) Error() string {
+	return fmt.Sprintf("Unable to insert %d into %s table: %v", e.ID, e.Table, e.Err)
+}
+
+// Unwrap returns the error of the database so errors.Is can find it.
+func (e *InsertError) Unwrap() error {
+	return e.Err
+}
+
 // result is what is sent back from each operation.
 type result struct {
 	id  int
@@ -49,16 +83,23 @@ func main() {
 	// Therefore, we set it to 20 inserts right out the box.
 	waitInserts := inserts
 
+	// Every Goroutine adds its errors here.
+	var errs errors.Collector
+
 	// Perform all the inserts. This is the fan out.
 	// We are gonna have 10 Goroutines. Each Goroutine performs 2 inserts. The result of the insert
 	// is used in a ch channel. Because this is a buffered channel, none of these send blocks.
 	for i := 0; i < routines; i++ {
 		go func(id int) {
-			ch <- insertUser(id)
+			r := insertUser(id)
+			errs.Add(r.err)
+			ch <- r
 
 			// We don't need to wait to start the second insert thanks to the buffered channel.
 			// The first send will happen immediately.
-			ch <- insertTrans(id)
+			r = insertTrans(id)
+			errs.Add(r.err)
+			ch <- r
 		}(i)
 	}
 
@@ -77,6 +118,25 @@ func main() {
 	}
 
 	log.Println("Inserts Complete")
+
+	// Every Goroutine sent its results after adding its errors, so by now they are all in.
+	err := errs.Err()
+	if err == nil {
+		log.Println("All inserts succeeded")
+		return
+	}
+
+	log.Printf("%d of %d inserts failed\n%v", errs.Len(), inserts, err)
+
+	// Ask about the failures as a whole.
+	if errors.Is(err, ErrDeadlock) {
+		log.Println("Some inserts hit a deadlock and can be tried again")
+	}
+
+	var ie *InsertError
+	if errors.As(err, &ie) {
+		log.Printf("First failure: table %s, id %d", ie.Table, ie.ID)
+	}
 }
 
 // insertUser simulates a database operation.
@@ -88,7 +148,7 @@ func insertUser(id int) result {
 
 	// Randomize if the insert fails or not.
 	if rand.Intn(10) == 0 {
-		r.err = fmt.Errorf("Unable to insert %d into USER table", id)
+		r.err = &InsertError{Table: "USERS", ID: id, Err: dbError()}
 	}
 
 	return r
@@ -103,8 +163,16 @@ func insertTrans(id int) result {
 
 	// Randomize if the insert fails or not.
 	if rand.Intn(10) == 0 {
-		r.err = fmt.Errorf("Unable to insert %d into USER table", id)
+		r.err = &InsertError{Table: "TRANS", ID: id, Err: dbError()}
 	}
 
 	return r
 }
+
+// dbError picks the reason an insert failed.
+func dbError() error {
+	if rand.Intn(2) == 0 {
+		return ErrDeadlock
+	}
+	return ErrConstraint
+}
@@ -0,0 +1,51 @@
+// -----------
+// Chat server
+// -----------
+
+// error_4.go has the read routine of a chat client but nothing to run it in. This is the server
+// around it. Every connection is asked for a name, then every line it sends goes to everybody else
+// in the room. Try it with a few terminals:
+//   go run ./go/design/chat
+//   nc localhost 6000
+
+// A client leaves when it closes the connection (io.EOF) or when a read fails with an error that
+// is not temporary. Temporary errors are logged and the client keeps going, like in
+// BehaviorAsContext.
+
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/hoanhan101/ultimate-go/go/design/chat/room"
+)
+
+func main() {
+	addr := flag.String("addr", ":6000", "`address` to listen on")
+	flag.Parse()
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r := room.New()
+
+	// Close the room on Ctrl-C, so every client is disconnected before the program ends.
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+		r.Close()
+	}()
+
+	log.Println("listener : Started : Listening on:", l.Addr())
+	if err := r.Serve(l); err != room.ErrClosed {
+		log.Fatal(err)
+	}
+	log.Println("listener : Stopped")
+}
@@ -0,0 +1,358 @@
+// Package room is the chat server that the client of error_4.go was written for.
+//
+// A Room accepts connections, asks each one for a name and sends every line it reads to everybody
+// else in the room. The read routine is BehaviorAsContext from error_4.go: a client leaves on
+// io.EOF or on an error that is not temporary, and keeps going on a temporary one.
+//
+// Serve takes any net.Listener and Handle takes any net.Conn, so a room can be tested in process
+// with net.Pipe or a loopback listener:
+//   r := room.New()
+//   srv, cli := net.Pipe()
+//   go r.Handle(srv)
+package room
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors/behavior"
+)
+
+// ErrClosed is returned by Serve after the room was closed.
+var ErrClosed = errors.New("room: closed")
+
+// Set of limits of a client.
+const (
+	// queue is the number of messages waiting to be written to a client. A client that falls
+	// further behind than that is disconnected, so a slow reader cannot hold up the room.
+	queue = 64
+
+	// maxTemporary is the number of temporary read errors in a row a client is allowed before it is
+	// disconnected. An error that says it is temporary but keeps coming back is not.
+	maxTemporary = 3
+)
+
+// client represents a single connection in the room.
+type client struct {
+	name   string
+	conn   net.Conn
+	reader *bufio.Reader
+	send   chan string   // messages waiting to be written to conn
+	done   chan struct{} // closed when the writer has stopped
+}
+
+// String returns the name of the client, or its address if it has no name yet.
+func (c *client) String() string {
+	if c.name != "" {
+		return c.name
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+// write writes the messages of the client until send is closed. After a failed write the
+// connection is closed, which makes the read routine leave, and the rest of the messages are
+// dropped.
+func (c *client) write() {
+	defer close(c.done)
+
+	for msg := range c.send {
+		if _, err := io.WriteString(c.conn, msg); err != nil {
+			c.conn.Close()
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+// Room is a chat room. The zero value is not usable, use New.
+type Room struct {
+	// Logf logs clients joining and leaving. nil means the log package.
+	Logf func(format string, args ...interface{})
+
+	mu        sync.Mutex
+	clients   map[*client]struct{}
+	conns     map[net.Conn]struct{}
+	listeners map[net.Listener]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns an empty room.
+func New() *Room {
+	return &Room{
+		clients:   make(map[*client]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+	}
+}
+
+// logf logs using Logf, or the log package if it is not set.
+func (r *Room) logf(format string, args ...interface{}) {
+	if r.Logf != nil {
+		r.Logf(format, args...)
+		return
+	}
+	log.Printf(format, args...)
+}
+
+// Serve accepts connections on l and handles each one in its own Goroutine. Temporary accept
+// errors, like running out of file descriptors, are waited out the same way net/http does.
+// Serve always returns a non-nil error, ErrClosed after Close.
+func (r *Room) Serve(l net.Listener) error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		l.Close()
+		return ErrClosed
+	}
+	r.listeners[l] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.listeners, l)
+		r.mu.Unlock()
+	}()
+
+	var wait time.Duration
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if r.isClosed() {
+				return ErrClosed
+			}
+
+			if behavior.IsTemporary(err) {
+				wait *= 2
+				if wait == 0 {
+					wait = 5 * time.Millisecond
+				}
+				if wait > time.Second {
+					wait = time.Second
+				}
+				r.logf("accept: %v: retrying in %v", err, wait)
+				time.Sleep(wait)
+				continue
+			}
+
+			return err
+		}
+		wait = 0
+
+		go r.Handle(conn)
+	}
+}
+
+// Handle runs the conversation with a single connection: it asks for a name, announces the client
+// and broadcasts every line it sends. It returns when the client has left and conn is closed.
+func (r *Room) Handle(conn net.Conn) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		conn.Close()
+		return
+	}
+	r.conns[conn] = struct{}{}
+	r.wg.Add(1)
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+
+		conn.Close()
+		r.wg.Done()
+	}()
+
+	c := client{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		send:   make(chan string, queue),
+		done:   make(chan struct{}),
+	}
+	go c.write()
+
+	// The connection is closed before waiting for the writer, so a peer that stopped reading
+	// cannot keep it blocked.
+	defer func() {
+		conn.Close()
+		<-c.done
+	}()
+
+	name, ok := r.name(&c)
+	if !ok {
+		close(c.send)
+		return
+	}
+	c.name = name
+
+	r.join(&c)
+	r.read(&c)
+	r.leave(&c)
+}
+
+// name asks the client for a name until it gets one that is not empty.
+func (r *Room) name(c *client) (string, bool) {
+	for {
+		c.send <- "What is your name?\n"
+
+		line, ok := r.readLine(c)
+		if !ok {
+			return "", false
+		}
+
+		if name := strings.TrimSpace(line); name != "" {
+			return name, true
+		}
+	}
+}
+
+// read broadcasts every line of the client until it leaves.
+func (r *Room) read(c *client) {
+	for {
+		line, ok := r.readLine(c)
+		if !ok {
+			return
+		}
+
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			r.broadcast(c, fmt.Sprintf("%s: %s\n", c.name, line))
+		}
+	}
+}
+
+// readLine is the read routine of BehaviorAsContext in error_4.go. It returns false when the
+// client is leaving.
+func (r *Room) readLine(c *client) (string, bool) {
+	temporaries := 0
+
+	// ReadString returns what it read before an error. After a temporary one, that is the start of
+	// the line the next read finishes.
+	var prefix string
+	for {
+		line, err := c.reader.ReadString('\n')
+		line = prefix + line
+		if err == nil {
+			return line, true
+		}
+
+		switch {
+		case err == io.EOF:
+			// A last line without a newline is still a line. The next call gets io.EOF again.
+			if line != "" {
+				return line, true
+			}
+			r.logf("EOF: %s leaving chat", c)
+			return "", false
+
+		case behavior.IsTemporary(err):
+			if temporaries++; temporaries >= maxTemporary {
+				r.logf("Temporary: %s leaving chat: %v", c, err)
+				return "", false
+			}
+			r.logf("read-routine: %s: %v", c, err)
+			prefix = line
+
+		default:
+			r.logf("%s leaving chat: %v", c, err)
+			return "", false
+		}
+	}
+}
+
+// join adds the client to the room and tells everybody, including the client.
+func (r *Room) join(c *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clients[c] = struct{}{}
+	msg := fmt.Sprintf("* %s joined, %d in the room\n", c.name, len(r.clients))
+	for other := range r.clients {
+		r.deliver(other, msg)
+	}
+
+	r.logf("%s joined", c)
+}
+
+// leave removes the client from the room, stops its writer and tells everybody else.
+func (r *Room) leave(c *client) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.clients, c)
+	close(c.send)
+
+	msg := fmt.Sprintf("* %s left, %d in the room\n", c.name, len(r.clients))
+	for other := range r.clients {
+		r.deliver(other, msg)
+	}
+}
+
+// broadcast sends the message to every client but the one it came from.
+func (r *Room) broadcast(from *client, msg string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for c := range r.clients {
+		if c != from {
+			r.deliver(c, msg)
+		}
+	}
+}
+
+// deliver queues the message for the client without waiting. A client whose queue is full is
+// disconnected, its read routine then takes it out of the room. It must be called with the lock.
+func (r *Room) deliver(c *client, msg string) {
+	select {
+	case c.send <- msg:
+	default:
+		r.logf("%s is too slow, disconnecting", c)
+		c.conn.Close()
+	}
+}
+
+// Len returns the number of clients in the room.
+func (r *Room) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.clients)
+}
+
+// isClosed reports whether Close was called.
+func (r *Room) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.closed
+}
+
+// Close stops every Serve, disconnects every client and waits for them to leave.
+func (r *Room) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	r.closed = true
+
+	for l := range r.listeners {
+		l.Close()
+	}
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return nil
+}
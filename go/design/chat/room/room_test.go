@@ -0,0 +1,314 @@
+// ---------
+// Room test
+// ---------
+
+// Run test using "go test -v ./go/design/chat/room"
+
+// We are using room_test for package name because we want to make sure we only touch the
+// exported API.
+package room_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/chat/room"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// user is the other side of a connection to the room.
+type user struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// newUser wraps the connection of a user.
+func newUser(conn net.Conn) *user {
+	return &user{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+// say sends a line to the room.
+func (u *user) say(line string) error {
+	u.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_, err := u.conn.Write([]byte(line + "\n"))
+	return err
+}
+
+// hear returns the next line from the room, without the newline.
+func (u *user) hear() (string, error) {
+	u.conn.SetReadDeadline(time.Now().Add(time.Second))
+	line, err := u.reader.ReadString('\n')
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+// join connects a user through net.Pipe and answers the question for the name.
+func join(t *testing.T, r *room.Room, name string) *user {
+	srv, cli := net.Pipe()
+	go r.Handle(srv)
+
+	u := newUser(cli)
+	if line, err := u.hear(); err != nil || line != "What is your name?" {
+		t.Fatalf("\t%s\tShould ask %s for a name : %q, %v", failed, name, line, err)
+	}
+	if err := u.say(name); err != nil {
+		t.Fatalf("\t%s\tShould send the name of %s : %v", failed, name, err)
+	}
+
+	return u
+}
+
+// expect reads the next line of u and compares it to want.
+func expect(t *testing.T, u *user, want string, should string) {
+	line, err := u.hear()
+	if err != nil || line != want {
+		t.Fatalf("\t%s\t%s : got %q, %v want %q", failed, should, line, err, want)
+	}
+	t.Logf("\t%s\t%s.", succeed, should)
+}
+
+// tempError is a read error that says it is temporary.
+type tempError struct{}
+
+func (tempError) Error() string   { return "resource temporarily unavailable" }
+func (tempError) Temporary() bool { return true }
+func (tempError) Timeout() bool   { return false }
+
+// flakyConn fails the first n reads with a temporary error.
+type flakyConn struct {
+	net.Conn
+
+	mu sync.Mutex
+	n  int
+}
+
+// Read fails with a temporary error while n is not 0.
+func (c *flakyConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	if c.n > 0 {
+		c.n--
+		c.mu.Unlock()
+		return 0, tempError{}
+	}
+	c.mu.Unlock()
+
+	return c.Conn.Read(p)
+}
+
+// cutConn fails the read that comes after a line was cut in the middle, once.
+type cutConn struct {
+	net.Conn
+
+	mu  sync.Mutex
+	cut bool
+}
+
+// Read fails with a temporary error when the last read didn't end with a newline.
+func (c *cutConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cut {
+		c.cut = false
+		return 0, tempError{}
+	}
+
+	n, err := c.Conn.Read(p)
+	c.cut = n > 0 && p[n-1] != '\n'
+	return n, err
+}
+
+// TestRoom validates joining, talking and leaving through net.Pipe.
+func TestRoom(t *testing.T) {
+	r := room.New()
+	r.Logf = t.Logf
+	defer r.Close()
+
+	t.Log("Given the need to talk to other people in a room.")
+	{
+		t.Logf("\tTest 0:\tWhen two people join.")
+		var alice, bob *user
+		{
+			alice = join(t, r, "alice")
+			expect(t, alice, "* alice joined, 1 in the room", "Should welcome alice")
+
+			// The empty name is asked again.
+			srv, cli := net.Pipe()
+			go r.Handle(srv)
+			bob = newUser(cli)
+			expect(t, bob, "What is your name?", "Should ask bob for a name")
+			bob.say("  ")
+			expect(t, bob, "What is your name?", "Should ask bob again after an empty name")
+			bob.say("bob")
+
+			expect(t, bob, "* bob joined, 2 in the room", "Should welcome bob")
+			expect(t, alice, "* bob joined, 2 in the room", "Should tell alice that bob joined")
+		}
+
+		t.Logf("\tTest 1:\tWhen alice says something.")
+		{
+			alice.say("hello")
+			alice.say("")
+			alice.say("how are you?")
+			expect(t, bob, "alice: hello", "Should send the line to bob")
+			expect(t, bob, "alice: how are you?", "Should skip the empty line")
+
+			bob.say("fine")
+			expect(t, alice, "bob: fine", "Should not send alice her own lines")
+		}
+
+		t.Logf("\tTest 2:\tWhen bob leaves.")
+		{
+			bob.conn.Close()
+			expect(t, alice, "* bob left, 1 in the room", "Should tell alice that bob left")
+
+			if n := r.Len(); n != 1 {
+				t.Fatalf("\t%s\tShould have 1 person in the room : %d", failed, n)
+			}
+			t.Logf("\t%s\tShould have 1 person in the room.", succeed)
+		}
+	}
+}
+
+// TestTemporary validates that a temporary read error doesn't make a client leave, unless it keeps
+// coming back.
+func TestTemporary(t *testing.T) {
+	r := room.New()
+	r.Logf = t.Logf
+	defer r.Close()
+
+	t.Log("Given the need to keep a client through temporary errors.")
+	{
+		alice := join(t, r, "alice")
+		expect(t, alice, "* alice joined, 1 in the room", "Should welcome alice")
+
+		t.Logf("\tTest 0:\tWhen a read fails once.")
+		{
+			srv, cli := net.Pipe()
+			go r.Handle(&flakyConn{Conn: srv, n: 1})
+
+			bob := newUser(cli)
+			expect(t, bob, "What is your name?", "Should ask bob for a name")
+			bob.say("bob")
+			expect(t, bob, "* bob joined, 2 in the room", "Should keep bob after the temporary error")
+			expect(t, alice, "* bob joined, 2 in the room", "Should tell alice that bob joined")
+		}
+
+		t.Logf("\tTest 1:\tWhen every read fails.")
+		{
+			srv, cli := net.Pipe()
+			done := make(chan struct{})
+			go func() {
+				r.Handle(&flakyConn{Conn: srv, n: 1000})
+				close(done)
+			}()
+
+			// carol may or may not get the question before she is disconnected.
+			defer cli.Close()
+
+			select {
+			case <-done:
+				t.Logf("\t%s\tShould disconnect carol.", succeed)
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tShould disconnect carol.", failed)
+			}
+
+			if n := r.Len(); n != 2 {
+				t.Fatalf("\t%s\tShould leave 2 people in the room : %d", failed, n)
+			}
+			t.Logf("\t%s\tShould leave 2 people in the room.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen a read fails in the middle of a line.")
+		{
+			srv, cli := net.Pipe()
+			go r.Handle(&cutConn{Conn: srv})
+
+			dave := newUser(cli)
+			expect(t, dave, "What is your name?", "Should ask dave for a name")
+			dave.say("dave")
+			expect(t, alice, "* dave joined, 3 in the room", "Should tell alice that dave joined")
+
+			dave.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			dave.conn.Write([]byte("hel"))
+			dave.say("lo")
+			expect(t, alice, "dave: hello", "Should keep the start of the line")
+		}
+	}
+}
+
+// TestServe validates the room over TCP on a loopback listener.
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("\t%s\tShould listen on the loopback : %v", failed, err)
+	}
+
+	r := room.New()
+	r.Logf = t.Logf
+
+	served := make(chan error, 1)
+	go func() {
+		served <- r.Serve(l)
+	}()
+
+	dial := func(name string) *user {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatalf("\t%s\tShould connect %s : %v", failed, name, err)
+		}
+
+		u := newUser(conn)
+		expect(t, u, "What is your name?", "Should ask "+name+" for a name")
+		u.say(name)
+		return u
+	}
+
+	t.Log("Given the need to run the room on a TCP listener.")
+	{
+		t.Logf("\tTest 0:\tWhen two people connect.")
+		{
+			alice := dial("alice")
+			expect(t, alice, "* alice joined, 1 in the room", "Should welcome alice")
+			bob := dial("bob")
+			expect(t, alice, "* bob joined, 2 in the room", "Should tell alice that bob joined")
+			expect(t, bob, "* bob joined, 2 in the room", "Should welcome bob")
+
+			bob.say("hi")
+			expect(t, alice, "bob: hi", "Should send the line to alice")
+		}
+
+		t.Logf("\tTest 1:\tWhen the room is closed.")
+		{
+			if err := r.Close(); err != nil {
+				t.Fatalf("\t%s\tShould close the room : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould close the room.", succeed)
+
+			select {
+			case err := <-served:
+				if err != room.ErrClosed {
+					t.Fatalf("\t%s\tShould return ErrClosed from Serve : %v", failed, err)
+				}
+				t.Logf("\t%s\tShould return ErrClosed from Serve.", succeed)
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tShould stop Serve.", failed)
+			}
+
+			if n := r.Len(); n != 0 {
+				t.Fatalf("\t%s\tShould disconnect everybody : %d", failed, n)
+			}
+			t.Logf("\t%s\tShould disconnect everybody.", succeed)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// ------------
+// Copy command
+// ------------
+
+// Up to now, the only way to run Copy was to edit main() in decoupling_4.go. This is a
+// proper command built on the same Copy. The source and the sink are picked by the scheme of a URI
+// so any Puller can be copied into any Storer without changing a line of code:
+//   copier -from file:///tmp/in.jsonl -to file:///tmp/out.csv
+//   copier -from mem://demo?n=10 -to stdout:
+//   copier -from http://localhost:8000 -to http://localhost:9000 -retries 3 -timeout 2s
+//   cat in.jsonl | copier -from - -to - -dry-run
+
+// A job can also be described by a config file. The source and the sink are picked by the name
+// they registered with in the pipeline package and each one decodes its own options:
+//   {
+//     "source": {"type": "http", "options": {"host": "localhost:8000", "timeout": "2s"}},
+//     "sink":   {"type": "file", "options": {"path": "/tmp/out.csv"}},
+//     "batch": 50,
+//     "retries": 3
+//   }
+//   copier -config job.json
+//   copier -config job.json -to stdout: -dry-run
+// Flags given on the command line override what is in the file.
+
+// The exit status tells a script what happened:
+//   0  everything was copied
+//   1  the copy failed before anything was stored
+//   2  the copy failed part way, some records were stored
+//   64 the command was used the wrong way
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/copier/pipeline"
+)
+
+// Set of exit status codes.
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitPartial = 2
+	exitUsage   = 64
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run executes the command with the arguments and returns the exit status.
+func run(args []string, log io.Writer) int {
+	fs := flag.NewFlagSet("copier", flag.ContinueOnError)
+	fs.SetOutput(log)
+
+	var (
+		config  = fs.String("config", "", "JSON `file` describing the source, the sink and the options")
+		from    = fs.String("from", "", "source `URI`: file://, mem://, http:// or stdin:")
+		to      = fs.String("to", "", "sink `URI`: file://, mem://, http:// or stdout:")
+		batch   = fs.Int("batch", 100, "number of records pulled before they are stored")
+		retries = fs.Int("retries", 0, "number of retries of a temporary failure")
+		timeout = fs.Duration("timeout", 5*time.Second, "timeout of a single call to a network system")
+		dryRun  = fs.Bool("dry-run", false, "pull everything but store nothing")
+	)
+
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	// The config file comes first. Any flag given on the command line overrides it.
+	cfg := pipeline.Config{
+		Batch:   *batch,
+		Retries: *retries,
+		DryRun:  *dryRun,
+	}
+
+	if *config != "" {
+		c, err := pipeline.LoadConfig(*config)
+		if err != nil {
+			fmt.Fprintln(log, "copier:", err)
+			return exitUsage
+		}
+		cfg = *c
+	}
+
+	opts := pipeline.Options{
+		Timeout: *timeout,
+	}
+
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	if set["batch"] {
+		cfg.Batch = *batch
+	}
+	if set["retries"] {
+		cfg.Retries = *retries
+	}
+	if set["dry-run"] {
+		cfg.DryRun = *dryRun
+	}
+
+	var err error
+	if set["from"] {
+		if cfg.Source, err = pipeline.SourceURI(*from, opts); err != nil {
+			fmt.Fprintln(log, "copier:", err)
+			return exitUsage
+		}
+	}
+	if set["to"] {
+		if cfg.Sink, err = pipeline.SinkURI(*to, opts); err != nil {
+			fmt.Fprintln(log, "copier:", err)
+			return exitUsage
+		}
+	}
+
+	// The timeout of the config file is overridden too, -from and -to already have the flag.
+	if set["timeout"] {
+		if err := cfg.SetTimeout(*timeout); err != nil {
+			fmt.Fprintln(log, "copier:", err)
+			return exitUsage
+		}
+	}
+
+	if cfg.Batch == 0 {
+		cfg.Batch = *batch
+	}
+
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintln(log, "copier:", err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	// A dry run never opens the sink, so nothing is created or truncated.
+	src, dst, err := cfg.Open()
+	if err != nil {
+		fmt.Fprintln(log, "copier:", err)
+		return exitFailed
+	}
+	defer src.Close()
+
+	backoff := pipeline.Backoff{
+		Attempts: cfg.Retries + 1,
+		Base:     100 * time.Millisecond,
+		Max:      5 * time.Second,
+	}
+
+	sys := pipeline.System{
+		Puller: &pipeline.RetryPuller{Puller: src, Backoff: backoff},
+		Storer: &pipeline.RetryStorer{Storer: dst, Backoff: backoff},
+	}
+
+	n, err := pipeline.Copy(&sys, cfg.Batch)
+
+	// The sink is closed before we decide anything. For a file, closing is what flushes the last
+	// records to disk and it can fail too.
+	if cerr := dst.Close(); cerr != nil && err == io.EOF {
+		err = cerr
+	}
+
+	switch {
+	case err == io.EOF:
+		if cfg.DryRun {
+			fmt.Fprintf(log, "copier: dry run, %d records would be stored\n", n)
+		} else {
+			fmt.Fprintf(log, "copier: %d records stored\n", n)
+		}
+		return exitOK
+
+	case n > 0:
+		fmt.Fprintf(log, "copier: %d records stored before: %v\n", n, err)
+		return exitPartial
+
+	default:
+		fmt.Fprintln(log, "copier:", err)
+		return exitFailed
+	}
+}
@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Decoder declares behavior for reading a single record.
+// It must return io.EOF when there are no more records.
+type Decoder interface {
+	Decode(d *Data) error
+}
+
+// Encoder declares behavior for writing a single record.
+type Encoder interface {
+	Encode(d *Data) error
+}
+
+// Codec declares behavior for creating decoders and encoders for a format.
+type Codec interface {
+	NewDecoder(r io.Reader) Decoder
+	NewEncoder(w io.Writer) Encoder
+}
+
+// JSONLines is a codec for one JSON document per line.
+type JSONLines struct{}
+
+// NewDecoder returns a Decoder that reads JSON documents from r.
+func (JSONLines) NewDecoder(r io.Reader) Decoder {
+	return &jsonDecoder{dec: json.NewDecoder(r)}
+}
+
+// NewEncoder returns an Encoder that writes one JSON document per line into w.
+func (JSONLines) NewEncoder(w io.Writer) Encoder {
+	return &jsonEncoder{enc: json.NewEncoder(w)}
+}
+
+// jsonDecoder reads Data out of JSON documents.
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+// Decode reads the next document into d.
+// Copy reuses the same Data values for every batch so we clear d first.
+func (dec *jsonDecoder) Decode(d *Data) error {
+	*d = Data{}
+	return dec.dec.Decode(d)
+}
+
+// jsonEncoder writes Data as JSON documents.
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+// Encode writes d as a single document.
+func (enc *jsonEncoder) Encode(d *Data) error {
+	return enc.enc.Encode(d)
+}
+
+// CSV is a codec for comma separated values where the first column is the line.
+type CSV struct{}
+
+// NewDecoder returns a Decoder that reads CSV rows from r.
+func (CSV) NewDecoder(r io.Reader) Decoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &csvDecoder{r: cr}
+}
+
+// NewEncoder returns an Encoder that writes CSV rows into w.
+func (CSV) NewEncoder(w io.Writer) Encoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+// csvDecoder reads Data out of CSV rows.
+type csvDecoder struct {
+	r *csv.Reader
+}
+
+// Decode reads the next row into d.
+func (dec *csvDecoder) Decode(d *Data) error {
+	record, err := dec.r.Read()
+	if err != nil {
+		return err
+	}
+
+	if len(record) == 0 {
+		return errors.New("csv: empty record")
+	}
+
+	d.Line = record[0]
+	return nil
+}
+
+// csvEncoder writes Data as CSV rows.
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+// Encode writes d as a single row.
+func (enc *csvEncoder) Encode(d *Data) error {
+	if err := enc.w.Write([]string{d.Line}); err != nil {
+		return err
+	}
+
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+// StreamPuller is a system we can pull data from any io.Reader with.
+type StreamPuller struct {
+	dec    Decoder
+	closer io.Closer
+}
+
+// NewStreamPuller returns a StreamPuller that decodes records from r in the format of the codec.
+// Close closes r when it implements io.Closer.
+func NewStreamPuller(r io.Reader, codec Codec) *StreamPuller {
+	sp := StreamPuller{
+		dec: codec.NewDecoder(bufio.NewReader(r)),
+	}
+
+	if c, ok := r.(io.Closer); ok {
+		sp.closer = c
+	}
+
+	return &sp
+}
+
+// Pull knows how to pull data out of the stream.
+func (sp *StreamPuller) Pull(d *Data) error {
+	return sp.dec.Decode(d)
+}
+
+// Close closes the underlying reader.
+func (sp *StreamPuller) Close() error {
+	if sp.closer == nil {
+		return nil
+	}
+
+	return sp.closer.Close()
+}
+
+// StreamStorer is a system we can store data into any io.Writer with.
+type StreamStorer struct {
+	w      *bufio.Writer
+	enc    Encoder
+	closer io.Closer
+}
+
+// NewStreamStorer returns a StreamStorer that encodes records into w in the format of the codec.
+// Close closes w when it implements io.Closer.
+func NewStreamStorer(w io.Writer, codec Codec) *StreamStorer {
+	bw := bufio.NewWriter(w)
+	ss := StreamStorer{
+		w:   bw,
+		enc: codec.NewEncoder(bw),
+	}
+
+	if c, ok := w.(io.Closer); ok {
+		ss.closer = c
+	}
+
+	return &ss
+}
+
+// Store knows how to store data into the stream.
+func (ss *StreamStorer) Store(d *Data) error {
+	return ss.enc.Encode(d)
+}
+
+// Close flushes everything that is still buffered and closes the underlying writer.
+func (ss *StreamStorer) Close() error {
+	err := ss.w.Flush()
+
+	if ss.closer != nil {
+		if cerr := ss.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,142 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration is a time.Duration that is written in JSON as a string like "1.5s" or "300ms".
+type Duration time.Duration
+
+// MarshalJSON implements the json.Marshaler interface.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"2s\": %s", b)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// Endpoint names a registered system and the options used to create it.
+type Endpoint struct {
+	Type    string          `json:"type"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+// Config describes a whole copy job:
+//   {
+//     "source": {"type": "http", "options": {"host": "localhost:8000", "timeout": "1s"}},
+//     "sink":   {"type": "file", "options": {"path": "out.csv"}},
+//     "batch": 100,
+//     "retries": 3
+//   }
+type Config struct {
+	Source  Endpoint `json:"source"`
+	Sink    Endpoint `json:"sink"`
+	Batch   int      `json:"batch,omitempty"`
+	Retries int      `json:"retries,omitempty"`
+	DryRun  bool     `json:"dry_run,omitempty"`
+}
+
+// SetTimeout sets the timeout of every network system of the config, the ones of type http. The
+// other options of the endpoints are kept as they are.
+func (cfg *Config) SetTimeout(d time.Duration) error {
+	for _, ep := range []*Endpoint{&cfg.Source, &cfg.Sink} {
+		if ep.Type != "http" {
+			continue
+		}
+
+		options := make(map[string]json.RawMessage)
+		if len(ep.Options) > 0 {
+			if err := json.Unmarshal(ep.Options, &options); err != nil {
+				return fmt.Errorf("pipeline: %s options: %w", ep.Type, err)
+			}
+		}
+
+		b, err := json.Marshal(Duration(d))
+		if err != nil {
+			return err
+		}
+		options["timeout"] = b
+
+		if ep.Options, err = json.Marshal(options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadConfig reads and validates the config file at path.
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cfg Config
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("pipeline: config %s: %w", path, err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("pipeline: config %s: %w", path, err)
+	}
+
+	return &cfg, nil
+}
+
+// Validate reports the first problem with the config.
+func (cfg *Config) Validate() error {
+	switch {
+	case cfg.Source.Type == "":
+		return errors.New("missing source type")
+	case cfg.Sink.Type == "" && !cfg.DryRun:
+		return errors.New("missing sink type")
+	case cfg.Batch < 0:
+		return errors.New("batch can't be negative")
+	case cfg.Retries < 0:
+		return errors.New("retries can't be negative")
+	}
+
+	return nil
+}
+
+// Open creates the source and the sink of the config from the registry. A dry run gets a Discard
+// sink and the configured sink is never created.
+func (cfg *Config) Open() (PullCloser, StoreCloser, error) {
+	p, err := NewPuller(cfg.Source.Type, cfg.Source.Options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.DryRun {
+		return p, &Discard{}, nil
+	}
+
+	s, err := NewStorer(cfg.Sink.Type, cfg.Sink.Options)
+	if err != nil {
+		p.Close()
+		return nil, nil, err
+	}
+
+	return p, s, nil
+}
@@ -0,0 +1,166 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// page is the body of a GET /data response.
+type page struct {
+	Data []Data `json:"data"`
+	Next int    `json:"next"`
+}
+
+// StatusError is returned when an HTTP system answers with a status code that is not 2xx.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+// Error implements the error interface.
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Code, http.StatusText(e.Code), e.Body)
+}
+
+// Temporary reports whether trying again may work: the server is overloaded or failing.
+func (e *StatusError) Temporary() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code >= 500
+}
+
+// NotFound reports whether the system said the data doesn't exist.
+func (e *StatusError) NotFound() bool {
+	return e.Code == http.StatusNotFound
+}
+
+// statusError turns a response that is not 2xx into a *StatusError.
+func statusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return &StatusError{
+		Code: resp.StatusCode,
+		Body: strings.TrimSpace(string(b)),
+	}
+}
+
+// HTTPPuller is a system we can pull data from with paged GET requests:
+//   GET http://{Host}/data?offset=0&limit=100
+//   {"data":[{"line":"..."}, ...],"next":100}
+type HTTPPuller struct {
+	Host     string
+	Timeout  time.Duration
+	PageSize int // zero means 100
+
+	client *http.Client
+	page   []Data
+	next   int
+	done   bool
+}
+
+// fetch gets the next page of records.
+func (hp *HTTPPuller) fetch() error {
+	if hp.client == nil {
+		hp.client = &http.Client{Timeout: hp.Timeout}
+	}
+
+	limit := hp.PageSize
+	if limit <= 0 {
+		limit = 100
+	}
+
+	q := url.Values{}
+	q.Set("offset", strconv.Itoa(hp.next))
+	q.Set("limit", strconv.Itoa(limit))
+
+	resp, err := hp.client.Get("http://" + hp.Host + "/data?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+
+	var p page
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return err
+	}
+
+	hp.page = p.Data
+	hp.next = p.Next
+	hp.done = len(p.Data) == 0
+	return nil
+}
+
+// Pull knows how to pull data out of the HTTP system.
+func (hp *HTTPPuller) Pull(d *Data) error {
+	if len(hp.page) == 0 && !hp.done {
+		if err := hp.fetch(); err != nil {
+			return err
+		}
+	}
+
+	if len(hp.page) == 0 {
+		return io.EOF
+	}
+
+	*d = hp.page[0]
+	hp.page = hp.page[1:]
+	return nil
+}
+
+// Close implements the io.Closer interface.
+func (hp *HTTPPuller) Close() error {
+	return nil
+}
+
+// HTTPStorer is a system we can store data into with POST requests:
+//   POST http://{Host}/data
+//   [{"line":"..."}, ...]
+type HTTPStorer struct {
+	Host    string
+	Timeout time.Duration
+
+	client *http.Client
+}
+
+// Store knows how to store data into the HTTP system.
+func (hs *HTTPStorer) Store(d *Data) error {
+	return hs.StoreBatch([]Data{*d})
+}
+
+// StoreBatch knows how to store many records into the HTTP system with a single request.
+func (hs *HTTPStorer) StoreBatch(data []Data) error {
+	if hs.client == nil {
+		hs.client = &http.Client{Timeout: hs.Timeout}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := hs.client.Post("http://"+hs.Host+"/data", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return statusError(resp)
+}
+
+// Close implements the io.Closer interface.
+func (hs *HTTPStorer) Close() error {
+	return nil
+}
@@ -0,0 +1,106 @@
+package pipeline
+
+import (
+	"io"
+	"sync"
+)
+
+// Mem is an in memory store of records. It can be both the source and the sink of a copy.
+type Mem struct {
+	mu   sync.Mutex
+	data []Data
+}
+
+// Append adds records to the end of the store.
+func (m *Mem) Append(data ...Data) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data = append(m.data, data...)
+}
+
+// Reset replaces every record in the store with the given records.
+func (m *Mem) Reset(data ...Data) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data = append([]Data(nil), data...)
+}
+
+// Records returns a copy of every record in the store.
+func (m *Mem) Records() []Data {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Data(nil), m.data...)
+}
+
+// Len returns the number of records in the store.
+func (m *Mem) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.data)
+}
+
+// Puller returns a Puller that reads the records in the store from the beginning. It reads the
+// records that are there when it is created, so a copy from a store into itself ends.
+func (m *Mem) Puller() PullCloser {
+	return &memPuller{data: m.Records()}
+}
+
+// Store knows how to store data into memory.
+func (m *Mem) Store(d *Data) error {
+	m.Append(*d)
+	return nil
+}
+
+// Close implements the io.Closer interface.
+func (m *Mem) Close() error {
+	return nil
+}
+
+// memPuller pulls a copy of the records of a Mem in order.
+type memPuller struct {
+	data []Data
+	pos  int
+}
+
+// Pull knows how to pull data out of memory.
+func (mp *memPuller) Pull(d *Data) error {
+	if mp.pos >= len(mp.data) {
+		return io.EOF
+	}
+
+	*d = mp.data[mp.pos]
+	mp.pos++
+	return nil
+}
+
+// Close implements the io.Closer interface.
+func (mp *memPuller) Close() error {
+	return nil
+}
+
+// mems holds the named in memory stores used by mem:// URIs.
+var mems = struct {
+	sync.Mutex
+	m map[string]*Mem
+}{
+	m: make(map[string]*Mem),
+}
+
+// NamedMem returns the in memory store with the given name, creating it the first time.
+// Every mem:// URI with the same name in the same process shares the store.
+func NamedMem(name string) *Mem {
+	mems.Lock()
+	defer mems.Unlock()
+
+	m, ok := mems.m[name]
+	if !ok {
+		m = new(Mem)
+		mems.m[name] = m
+	}
+
+	return m
+}
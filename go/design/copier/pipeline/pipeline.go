@@ -0,0 +1,154 @@
+// Package pipeline provides the Puller and Storer systems the copier command moves data between.
+// It collects the systems and decorators from the decoupling examples into a package that can be
+// imported.
+package pipeline
+
+import (
+	"errors"
+	"io"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string `json:"line"`
+}
+
+// Puller declares behavior for pulling data.
+// Pull must return io.EOF once there is no more data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// BatchStorer declares behavior for storing many records at once, like one request per batch for
+// an HTTP system. Either all of the records are stored or none of them are.
+type BatchStorer interface {
+	StoreBatch(data []Data) error
+}
+
+// ErrBatchUnsupported is returned by a StoreBatch that can't store a batch at once, usually a
+// decorator whose inner Storer doesn't know how. Nothing was stored and the records have to be
+// stored one at a time instead.
+var ErrBatchUnsupported = errors.New("pipeline: store batch not supported")
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// PullCloser declares behaviors for pulling data and releasing the source.
+type PullCloser interface {
+	Puller
+	io.Closer
+}
+
+// StoreCloser declares behaviors for storing data and releasing the sink.
+// Close must be called for everything that was stored to be guaranteed to reach the sink.
+type StoreCloser interface {
+	Storer
+	io.Closer
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// StoreBatch knows how to store many records into the embedded Storer, when the Storer knows how
+// to store a batch. Only the methods of the Storer interface are promoted from the embedded
+// field, so System has to pass the behavior through itself.
+func (s *System) StoreBatch(data []Data) error {
+	return storeBatch(s.Storer, data)
+}
+
+// storeBatch stores the records with a single StoreBatch call, or returns ErrBatchUnsupported if s
+// doesn't have that behavior.
+func storeBatch(s Storer, data []Data) error {
+	bs, ok := s.(BatchStorer)
+	if !ok {
+		return ErrBatchUnsupported
+	}
+
+	return bs.StoreBatch(data)
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+// When the Storer can store a whole batch at once, we let it. Either all of the batch is stored or
+// none of it is. Otherwise every record is stored on its own and we count how many made it.
+func store(s Storer, data []Data) (int, error) {
+	err := storeBatch(s, data)
+	if err == nil {
+		return len(data), nil
+	}
+	if err != ErrBatchUnsupported {
+		return 0, err
+	}
+
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+// It returns the number of records that were stored and the error that ended the copy, which is
+// io.EOF when everything was copied.
+func Copy(ps PullStorer, batch int) (int, error) {
+	if batch < 1 {
+		batch = 1
+	}
+
+	data := make([]Data, batch)
+	var stored int
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			n, err := store(ps, data[:i])
+			stored += n
+			if err != nil {
+				return stored, err
+			}
+		}
+
+		if err != nil {
+			return stored, err
+		}
+	}
+}
+
+// Discard is a Storer that counts the records it is given and stores them nowhere.
+type Discard struct {
+	Count int
+}
+
+// Store knows how to store data into nowhere.
+func (d *Discard) Store(*Data) error {
+	d.Count++
+	return nil
+}
+
+// Close implements the io.Closer interface.
+func (d *Discard) Close() error {
+	return nil
+}
@@ -0,0 +1,322 @@
+// -------------
+// Pipeline test
+// -------------
+
+// Run test using "go test -v ./go/design/copier/pipeline"
+
+// We are using pipeline_test for package name because we want to make sure we only touch the
+// exported API.
+package pipeline_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/copier/pipeline"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// TestRoundTrip copies records from memory into a file and back.
+func TestRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Log("Given the need to copy records through a file.")
+	{
+		for i, ext := range []string{"jsonl", "csv"} {
+			path := filepath.Join(dir, "data."+ext)
+
+			t.Logf("\tTest %d:\tWhen copying 5 records through a %s file.", i, ext)
+			{
+				src, err := pipeline.OpenPuller("mem://round-"+ext+"?n=5", pipeline.Options{})
+				if err != nil {
+					t.Fatalf("\t%s\tShould be able to open the source : %v", failed, err)
+				}
+
+				dst, err := pipeline.CreateStorer("file://"+path, pipeline.Options{})
+				if err != nil {
+					t.Fatalf("\t%s\tShould be able to create the sink : %v", failed, err)
+				}
+
+				n, err := pipeline.Copy(&pipeline.System{Puller: src, Storer: dst}, 2)
+				if err != io.EOF || n != 5 {
+					t.Fatalf("\t%s\tShould store 5 records : %d, %v", failed, n, err)
+				}
+				if err := dst.Close(); err != nil {
+					t.Fatalf("\t%s\tShould be able to close the sink : %v", failed, err)
+				}
+				t.Logf("\t%s\tShould store 5 records.", succeed)
+
+				src, err = pipeline.OpenPuller("file://"+path, pipeline.Options{})
+				if err != nil {
+					t.Fatalf("\t%s\tShould be able to open the file : %v", failed, err)
+				}
+				defer src.Close()
+
+				var back pipeline.Mem
+				if _, err := pipeline.Copy(&pipeline.System{Puller: src, Storer: &back}, 2); err != io.EOF {
+					t.Fatalf("\t%s\tShould be able to read the file back : %v", failed, err)
+				}
+
+				want := pipeline.NamedMem("round-" + ext).Records()
+				got := back.Records()
+				if len(got) != len(want) {
+					t.Fatalf("\t%s\tShould read back %d records : %d", failed, len(want), len(got))
+				}
+				for j := range want {
+					if got[j] != want[j] {
+						t.Fatalf("\t%s\tShould read back %q at %d : %q", failed, want[j].Line, j, got[j].Line)
+					}
+				}
+				t.Logf("\t%s\tShould read back the same records.", succeed)
+			}
+		}
+	}
+}
+
+// TestHTTPBatch validates that an HTTP sink gets one request per batch, through the decorators.
+func TestHTTPBatch(t *testing.T) {
+	var mu sync.Mutex
+	var posts, records int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data []pipeline.Data
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		posts++
+		records += len(data)
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	t.Log("Given the need to store batches into an HTTP system.")
+	{
+		t.Logf("\tTest 0:\tWhen copying 5 records in batches of 2.")
+		{
+			var m pipeline.Mem
+			for i := 0; i < 5; i++ {
+				m.Append(pipeline.Data{Line: "data"})
+			}
+
+			dst, err := pipeline.CreateStorer(srv.URL, pipeline.Options{})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create the sink : %v", failed, err)
+			}
+
+			sys := pipeline.System{
+				Puller: m.Puller(),
+				Storer: &pipeline.RetryStorer{Storer: dst, Backoff: pipeline.Backoff{Attempts: 2}},
+			}
+			if n, err := pipeline.Copy(&sys, 2); err != io.EOF || n != 5 {
+				t.Fatalf("\t%s\tShould store 5 records : %d, %v", failed, n, err)
+			}
+			t.Logf("\t%s\tShould store 5 records.", succeed)
+
+			if posts != 3 || records != 5 {
+				t.Fatalf("\t%s\tShould send 3 requests : %d requests, %d records", failed, posts, records)
+			}
+			t.Logf("\t%s\tShould send 3 requests.", succeed)
+		}
+	}
+}
+
+// TestMemSelf validates a copy from a named store into itself.
+func TestMemSelf(t *testing.T) {
+	t.Log("Given the need to copy a store into itself.")
+	{
+		t.Logf("\tTest 0:\tWhen the source and the sink have the same name.")
+		{
+			src, err := pipeline.OpenPuller("mem://self?n=3", pipeline.Options{})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to open the source : %v", failed, err)
+			}
+
+			dst, err := pipeline.CreateStorer("mem://self", pipeline.Options{})
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to create the sink : %v", failed, err)
+			}
+
+			if n, err := pipeline.Copy(&pipeline.System{Puller: src, Storer: dst}, 2); err != io.EOF || n != 3 {
+				t.Fatalf("\t%s\tShould store the 3 records that were there : %d, %v", failed, n, err)
+			}
+			t.Logf("\t%s\tShould store the 3 records that were there.", succeed)
+
+			if n := pipeline.NamedMem("self").Len(); n != 6 {
+				t.Fatalf("\t%s\tShould end with 6 records : %d", failed, n)
+			}
+			t.Logf("\t%s\tShould end with 6 records.", succeed)
+		}
+	}
+}
+
+// failing is a Storer that fails after storing a number of records.
+type failing struct {
+	left int
+}
+
+var errFull = errors.New("full")
+
+func (f *failing) Store(*pipeline.Data) error {
+	if f.left == 0 {
+		return errFull
+	}
+	f.left--
+	return nil
+}
+
+// TestPartialCopy validates the count returned when the copy fails part way.
+func TestPartialCopy(t *testing.T) {
+	t.Log("Given the need to know how much was stored before a failure.")
+	{
+		t.Logf("\tTest 0:\tWhen the sink fails after 3 of 10 records.")
+		{
+			var m pipeline.Mem
+			for i := 0; i < 10; i++ {
+				m.Append(pipeline.Data{Line: "data"})
+			}
+
+			n, err := pipeline.Copy(&pipeline.System{Puller: m.Puller(), Storer: &failing{left: 3}}, 4)
+			if err != errFull {
+				t.Fatalf("\t%s\tShould return the error of the sink : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return the error of the sink.", succeed)
+
+			if n != 3 {
+				t.Fatalf("\t%s\tShould report 3 records stored : %d", failed, n)
+			}
+			t.Logf("\t%s\tShould report 3 records stored.", succeed)
+		}
+	}
+}
+
+// TestUnsupported validates URIs that do not name a system.
+func TestUnsupported(t *testing.T) {
+	uris := []string{
+		"ftp://host/data",
+		"file:///tmp/data.xml",
+		"mem://name?n=many",
+	}
+
+	t.Log("Given the need to reject URIs we can't open.")
+	{
+		for i, uri := range uris {
+			t.Logf("\tTest %d:\tWhen opening %q.", i, uri)
+			{
+				if _, err := pipeline.OpenPuller(uri, pipeline.Options{}); err == nil {
+					t.Fatalf("\t%s\tShould receive an error.", failed)
+				}
+				t.Logf("\t%s\tShould receive an error.", succeed)
+			}
+		}
+	}
+}
+
+// sink receives the records of the "test" system. RegisterStorer panics when a name is registered
+// twice, so this happens once, not every time TestConfig runs.
+var sink pipeline.Mem
+
+func init() {
+	pipeline.RegisterStorer("test", func(options json.RawMessage) (pipeline.StoreCloser, error) {
+		return &sink, nil
+	})
+}
+
+// TestConfig validates a job assembled from a config file and a registered factory.
+func TestConfig(t *testing.T) {
+	sink.Reset()
+
+	dir, err := ioutil.TempDir("", "pipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "job.json")
+	job := `{
+		"source": {"type": "mem", "options": {"name": "config", "n": 3}},
+		"sink": {"type": "test"},
+		"batch": 2
+	}`
+	if err := ioutil.WriteFile(path, []byte(job), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Log("Given the need to assemble a copy from a config file.")
+	{
+		t.Logf("\tTest 0:\tWhen the sink is a registered factory.")
+		{
+			cfg, err := pipeline.LoadConfig(path)
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to load the config : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould be able to load the config.", succeed)
+
+			src, dst, err := cfg.Open()
+			if err != nil {
+				t.Fatalf("\t%s\tShould be able to open the source and the sink : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould be able to open the source and the sink.", succeed)
+
+			if n, err := pipeline.Copy(&pipeline.System{Puller: src, Storer: dst}, cfg.Batch); err != io.EOF || n != 3 {
+				t.Fatalf("\t%s\tShould store 3 records : %d, %v", failed, n, err)
+			}
+			if sink.Len() != 3 {
+				t.Fatalf("\t%s\tShould store 3 records into the registered sink : %d", failed, sink.Len())
+			}
+			t.Logf("\t%s\tShould store 3 records into the registered sink.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen the options have a typo.")
+		{
+			_, err := pipeline.NewPuller("mem", json.RawMessage(`{"nmae": "config"}`))
+			if err == nil {
+				t.Fatalf("\t%s\tShould receive an error.", failed)
+			}
+			t.Logf("\t%s\tShould receive an error.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen the timeout is given on the command line.")
+		{
+			cfg := pipeline.Config{
+				Source: pipeline.Endpoint{Type: "http", Options: json.RawMessage(`{"host": "xenia:8000", "timeout": "5s", "page_size": 10}`)},
+				Sink:   pipeline.Endpoint{Type: "test"},
+			}
+			if err := cfg.SetTimeout(time.Second); err != nil {
+				t.Fatalf("\t%s\tShould set the timeout : %v", failed, err)
+			}
+
+			var o map[string]interface{}
+			json.Unmarshal(cfg.Source.Options, &o)
+			if o["timeout"] != "1s" || o["host"] != "xenia:8000" || o["page_size"] != 10.0 {
+				t.Fatalf("\t%s\tShould replace the timeout of the http source only : %s", failed, cfg.Source.Options)
+			}
+			t.Logf("\t%s\tShould replace the timeout of the http source only.", succeed)
+
+			if cfg.Sink.Options != nil {
+				t.Fatalf("\t%s\tShould leave the other systems alone : %s", failed, cfg.Sink.Options)
+			}
+			t.Logf("\t%s\tShould leave the other systems alone.", succeed)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PullerFactory creates a source from its options. options is the raw JSON object from the
+// config, each factory decodes it into whatever shape it needs. It is nil when there are none.
+type PullerFactory func(options json.RawMessage) (PullCloser, error)
+
+// StorerFactory creates a sink from its options.
+type StorerFactory func(options json.RawMessage) (StoreCloser, error)
+
+// registry holds every factory by name. Systems register themselves in an init function, the same
+// way database/sql drivers and image formats do.
+var registry = struct {
+	sync.RWMutex
+	pullers map[string]PullerFactory
+	storers map[string]StorerFactory
+}{
+	pullers: make(map[string]PullerFactory),
+	storers: make(map[string]StorerFactory),
+}
+
+// RegisterPuller makes a source available by name.
+// It panics if it is called twice with the same name or if the factory is nil.
+func RegisterPuller(name string, f PullerFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if f == nil {
+		panic("pipeline: RegisterPuller factory is nil")
+	}
+	if _, dup := registry.pullers[name]; dup {
+		panic("pipeline: RegisterPuller called twice for " + name)
+	}
+
+	registry.pullers[name] = f
+}
+
+// RegisterStorer makes a sink available by name.
+// It panics if it is called twice with the same name or if the factory is nil.
+func RegisterStorer(name string, f StorerFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if f == nil {
+		panic("pipeline: RegisterStorer factory is nil")
+	}
+	if _, dup := registry.storers[name]; dup {
+		panic("pipeline: RegisterStorer called twice for " + name)
+	}
+
+	registry.storers[name] = f
+}
+
+// NewPuller creates the source registered under name.
+func NewPuller(name string, options json.RawMessage) (PullCloser, error) {
+	registry.RLock()
+	f, ok := registry.pullers[name]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("pipeline: unknown source %q", name)
+	}
+
+	p, err := f(options)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: source %q: %w", name, err)
+	}
+
+	return p, nil
+}
+
+// NewStorer creates the sink registered under name.
+func NewStorer(name string, options json.RawMessage) (StoreCloser, error) {
+	registry.RLock()
+	f, ok := registry.storers[name]
+	registry.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("pipeline: unknown sink %q", name)
+	}
+
+	s, err := f(options)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline: sink %q: %w", name, err)
+	}
+
+	return s, nil
+}
+
+// Pullers returns the sorted names of the registered sources.
+func Pullers() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var names []string
+	for name := range registry.pullers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Storers returns the sorted names of the registered sinks.
+func Storers() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	var names []string
+	for name := range registry.storers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// decodeOptions decodes the options of a factory into v. Unknown fields are an error, a typo in a
+// config file should not be silently ignored.
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// fileOptions are the options of the systems that read or write a stream of records.
+type fileOptions struct {
+	Path   string `json:"path,omitempty"`
+	Format string `json:"format,omitempty"`
+}
+
+// decode decodes the options of a factory into o.
+func (o *fileOptions) decode(options json.RawMessage) error {
+	return decodeOptions(options, o)
+}
+
+// format returns the format of the file, from the extension of the path when it is not set.
+func (o *fileOptions) format() string {
+	if o.Format != "" {
+		return o.Format
+	}
+
+	return strings.TrimPrefix(filepath.Ext(o.Path), ".")
+}
+
+// codecNamed returns the codec for a format. An empty format is JSON lines.
+func codecNamed(format string) (Codec, error) {
+	switch format {
+	case "csv":
+		return CSV{}, nil
+	case "", "json", "jsonl":
+		return JSONLines{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported format %q", format)
+}
+
+// The systems of this package register themselves under these names:
+//   file    {"path": "data.csv", "format": "csv"}
+//   mem     {"name": "demo", "n": 10}
+//   http    {"host": "localhost:8000", "timeout": "2s", "page_size": 100}
+//   stdin   {"format": "jsonl"}
+//   stdout  {"format": "jsonl"}
+// format is optional for files, the extension of the path is used when it is missing.
+func init() {
+	RegisterPuller("file", func(options json.RawMessage) (PullCloser, error) {
+		var o fileOptions
+		if err := o.decode(options); err != nil {
+			return nil, err
+		}
+
+		codec, err := codecNamed(o.format())
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Open(o.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewStreamPuller(f, codec), nil
+	})
+
+	RegisterStorer("file", func(options json.RawMessage) (StoreCloser, error) {
+		var o fileOptions
+		if err := o.decode(options); err != nil {
+			return nil, err
+		}
+
+		codec, err := codecNamed(o.format())
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := os.Create(o.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewStreamStorer(f, codec), nil
+	})
+
+	RegisterPuller("mem", func(options json.RawMessage) (PullCloser, error) {
+		var o struct {
+			Name string `json:"name"`
+			N    int    `json:"n"`
+		}
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+
+		// Generated records replace what is in the store, so opening the same source twice pulls
+		// the same records twice.
+		m := NamedMem(o.Name)
+		if o.N > 0 {
+			data := make([]Data, o.N)
+			for i := range data {
+				data[i] = Data{Line: fmt.Sprintf("Data %d", i+1)}
+			}
+			m.Reset(data...)
+		}
+
+		return m.Puller(), nil
+	})
+
+	RegisterStorer("mem", func(options json.RawMessage) (StoreCloser, error) {
+		var o struct {
+			Name string `json:"name"`
+		}
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+
+		return NamedMem(o.Name), nil
+	})
+
+	RegisterPuller("http", func(options json.RawMessage) (PullCloser, error) {
+		var o struct {
+			Host     string   `json:"host"`
+			Timeout  Duration `json:"timeout"`
+			PageSize int      `json:"page_size"`
+		}
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		if o.Host == "" {
+			return nil, errors.New("missing host")
+		}
+
+		hp := HTTPPuller{
+			Host:     o.Host,
+			Timeout:  time.Duration(o.Timeout),
+			PageSize: o.PageSize,
+		}
+
+		return &hp, nil
+	})
+
+	RegisterStorer("http", func(options json.RawMessage) (StoreCloser, error) {
+		var o struct {
+			Host    string   `json:"host"`
+			Timeout Duration `json:"timeout"`
+		}
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		if o.Host == "" {
+			return nil, errors.New("missing host")
+		}
+
+		hs := HTTPStorer{
+			Host:    o.Host,
+			Timeout: time.Duration(o.Timeout),
+		}
+
+		return &hs, nil
+	})
+
+	RegisterPuller("stdin", func(options json.RawMessage) (PullCloser, error) {
+		var o fileOptions
+		if err := o.decode(options); err != nil {
+			return nil, err
+		}
+
+		codec, err := codecNamed(o.Format)
+		if err != nil {
+			return nil, err
+		}
+
+		// Hiding os.Stdin behind io.Reader keeps Close from closing it.
+		return NewStreamPuller(struct{ io.Reader }{os.Stdin}, codec), nil
+	})
+
+	RegisterStorer("stdout", func(options json.RawMessage) (StoreCloser, error) {
+		var o fileOptions
+		if err := o.decode(options); err != nil {
+			return nil, err
+		}
+
+		codec, err := codecNamed(o.Format)
+		if err != nil {
+			return nil, err
+		}
+
+		// Hiding os.Stdout behind io.Writer keeps Close from closing it.
+		return NewStreamStorer(struct{ io.Writer }{os.Stdout}, codec), nil
+	})
+}
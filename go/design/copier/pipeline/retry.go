@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors/behavior"
+)
+
+// Clock declares behavior for waiting.
+type Clock interface {
+	Sleep(d time.Duration)
+}
+
+// realClock waits using the real time.
+type realClock struct{}
+
+// Sleep pauses the current Goroutine for at least the duration d.
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Backoff describes how many times to try and how long to wait in between.
+type Backoff struct {
+	Attempts int           // Total number of calls, including the first one.
+	Base     time.Duration // Wait before the first retry.
+	Max      time.Duration // Upper bound for any single wait.
+	Clock    Clock         // nil means the real time.
+}
+
+// wait returns how long to wait before the given retry, starting at 0.
+// The wait doubles on every retry and is capped at Max. The jitter takes up to half of it off.
+func (b *Backoff) wait(retry int) time.Duration {
+	d := b.Base
+	for i := 0; i < retry; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			d = b.Max
+			break
+		}
+	}
+
+	// A Base above Max is capped too, even for the first retry where the loop doesn't run.
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+
+	half := int64(d / 2)
+	if half == 0 {
+		return d
+	}
+
+	return d - time.Duration(rand.Int63n(half))
+}
+
+// do calls fn until it succeeds, returns an error that is not retryable or runs out of attempts.
+// Temporary errors and timeouts are retried, see behavior.IsRetryable.
+func (b *Backoff) do(fn func() error) error {
+	attempts := b.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	clock := b.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			clock.Sleep(b.wait(attempt - 1))
+		}
+
+		if err = fn(); err == nil || !behavior.IsRetryable(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+// RetryPuller is a Puller that retries temporary failures and timeouts of another Puller.
+type RetryPuller struct {
+	Puller  Puller
+	Backoff Backoff
+}
+
+// Pull knows how to pull data out of the inner Puller, trying again when it is temporary.
+func (r *RetryPuller) Pull(d *Data) error {
+	return r.Backoff.do(func() error {
+		return r.Puller.Pull(d)
+	})
+}
+
+// RetryStorer is a Storer that retries temporary failures and timeouts of another Storer.
+type RetryStorer struct {
+	Storer  Storer
+	Backoff Backoff
+}
+
+// Store knows how to store data into the inner Storer, trying again when it is temporary.
+func (r *RetryStorer) Store(d *Data) error {
+	return r.Backoff.do(func() error {
+		return r.Storer.Store(d)
+	})
+}
+
+// StoreBatch knows how to store a batch into the inner Storer, trying the whole batch again when
+// it is temporary. It returns ErrBatchUnsupported right away if the inner Storer can't store
+// batches.
+func (r *RetryStorer) StoreBatch(data []Data) error {
+	if _, ok := r.Storer.(BatchStorer); !ok {
+		return ErrBatchUnsupported
+	}
+
+	return r.Backoff.do(func() error {
+		return storeBatch(r.Storer, data)
+	})
+}
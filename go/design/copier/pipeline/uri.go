@@ -0,0 +1,135 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Options are the settings shared by every system opened from a URI.
+type Options struct {
+	Timeout time.Duration // timeout of a single call for network systems
+}
+
+// OpenPuller returns the source described by the URI:
+//   file:///path/to/data.jsonl   records in a file, CSV when the extension is .csv
+//   mem://name?n=10              named in memory store, filled with n generated records first
+//   http://host:port?page=100    paged HTTP source
+//   stdin: or -                  records on standard input
+// Files and stdin take a format=jsonl|csv query parameter to override the format.
+// The scheme is the name of the system in the registry.
+func OpenPuller(uri string, opts Options) (PullCloser, error) {
+	ep, err := SourceURI(uri, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPuller(ep.Type, ep.Options)
+}
+
+// CreateStorer returns the sink described by the URI:
+//   file:///path/to/data.csv     records in a file, CSV when the extension is .csv
+//   mem://name                   named in memory store
+//   http://host:port             HTTP sink
+//   stdout: or -                 records on standard output
+// Files and stdout take a format=jsonl|csv query parameter to override the format.
+// The scheme is the name of the system in the registry.
+func CreateStorer(uri string, opts Options) (StoreCloser, error) {
+	ep, err := SinkURI(uri, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStorer(ep.Type, ep.Options)
+}
+
+// SourceURI translates the URI of a source into the same Endpoint a config file would have.
+func SourceURI(uri string, opts Options) (Endpoint, error) {
+	if uri == "-" {
+		uri = "stdin:"
+	}
+
+	return endpoint(uri, opts)
+}
+
+// SinkURI translates the URI of a sink into the same Endpoint a config file would have.
+func SinkURI(uri string, opts Options) (Endpoint, error) {
+	if uri == "-" {
+		uri = "stdout:"
+	}
+
+	return endpoint(uri, opts)
+}
+
+// endpoint translates a URI into an Endpoint.
+func endpoint(uri string, opts Options) (Endpoint, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	q := u.Query()
+	options := make(map[string]interface{})
+
+	switch u.Scheme {
+	case "file":
+		options["path"] = filePath(u)
+		if f := q.Get("format"); f != "" {
+			options["format"] = f
+		}
+
+	case "mem":
+		options["name"] = u.Host
+		if s := q.Get("n"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return Endpoint{}, fmt.Errorf("pipeline: invalid n %q in %s", s, uri)
+			}
+			options["n"] = n
+		}
+
+	case "http":
+		options["host"] = u.Host
+		options["timeout"] = Duration(opts.Timeout)
+		if s := q.Get("page"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return Endpoint{}, fmt.Errorf("pipeline: invalid page %q in %s", s, uri)
+			}
+			options["page_size"] = n
+		}
+
+	case "stdin", "stdout":
+		if f := q.Get("format"); f != "" {
+			options["format"] = f
+		}
+
+	default:
+		return Endpoint{}, fmt.Errorf("pipeline: unsupported URI %q", uri)
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return Endpoint{}, err
+	}
+
+	ep := Endpoint{
+		Type:    u.Scheme,
+		Options: b,
+	}
+
+	return ep, nil
+}
+
+// filePath returns the path of a file URI. Both file:///abs/path and file://rel/path are
+// accepted, the second one is relative to the working directory.
+func filePath(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+
+	return filepath.FromSlash(u.Host + u.Path)
+}
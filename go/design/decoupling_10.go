@@ -0,0 +1,320 @@
+// -----------------------
+// Decoupling With Fan Out
+// -----------------------
+
+// We regularly need to write the same stream of Data into more than one place, for example a
+// primary store and an audit store. Copy only knows about one Storer and it should stay that way.
+
+// MultiStorer is a Storer that stores a list of other Storers. When we call Store on it, it calls
+// Store on every one of them. To Copy, it is just another Storer. This is the same idea as
+// io.MultiWriter in the standard library.
+
+// Not every job needs every destination to succeed. The Policy decides:
+// - All: every destination must store the record. One failure fails the record.
+// - Quorum: more than half of the destinations must store the record.
+// - BestEffort: the record is stored as long as a single destination took it.
+
+// When the policy is not met, we return a single error value: *MultiError. It holds the error of
+// every destination that failed, by index, so the caller can ask which ones went wrong. Copy returns
+// that error untouched and main uses errors.As to get back to the concrete type.
+// When the policy is met but some destinations still failed, that is not an error for Copy. The
+// failures are remembered on the MultiStorer so they can be reported at the end of the job.
+
+//                             ---> Pillar (primary)
+//   Copy ---store---> MultiStorer ---> Pillar (audit)
+//                             ---> Pillar (backup)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1, 9:
+		return io.EOF
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+// Every now and then it fails, based on the FailRate between 0 and 1.
+type Pillar struct {
+	Host     string
+	Timeout  time.Duration
+	FailRate float64
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	if rand.Float64() < p.FailRate {
+		return fmt.Errorf("Error writing data to Pillar at %s", p.Host)
+	}
+
+	fmt.Printf("Out[%s]: %s\n", p.Host, d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Policy decides how many destinations must succeed for a record to be stored.
+type Policy int
+
+// Set of policies a MultiStorer supports.
+const (
+	All Policy = iota
+	Quorum
+	BestEffort
+)
+
+// String returns the name of the policy.
+func (p Policy) String() string {
+	switch p {
+	case All:
+		return "all"
+	case Quorum:
+		return "quorum"
+	case BestEffort:
+		return "best-effort"
+	}
+
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// required returns how many of n destinations must succeed.
+func (p Policy) required(n int) int {
+	switch p {
+	case Quorum:
+		return n/2 + 1
+	case BestEffort:
+		return 1
+	}
+
+	return n
+}
+
+// MultiError describes the destinations that failed to store a record.
+type MultiError struct {
+	Policy    Policy
+	Succeeded int
+	Errors    map[int]error // error by index of the destination
+}
+
+// Indexes returns the indexes of the destinations that failed, in order.
+func (e *MultiError) Indexes() []int {
+	idx := make([]int, 0, len(e.Errors))
+	for i := range e.Errors {
+		idx = append(idx, i)
+	}
+	sort.Ints(idx)
+
+	return idx
+}
+
+// Error implements the error interface.
+func (e *MultiError) Error() string {
+	idx := e.Indexes()
+
+	msgs := make([]string, len(idx))
+	for i, n := range idx {
+		msgs[i] = fmt.Sprintf("[%d] %v", n, e.Errors[n])
+	}
+
+	return fmt.Sprintf("multi store: policy %s not met, %d succeeded, %d failed: %s",
+		e.Policy, e.Succeeded, len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Is reports whether any of the destination errors matches target.
+// This way errors.Is keeps working on the original errors after they were collected.
+func (e *MultiError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first destination error, by index, that matches target.
+// This way errors.As can still get to a typed error of one of the destinations.
+func (e *MultiError) As(target interface{}) bool {
+	for _, i := range e.Indexes() {
+		if errors.As(e.Errors[i], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MultiStorer is a Storer that stores every record into a list of Storers.
+type MultiStorer struct {
+	Storers []Storer
+	Policy  Policy
+
+	// Failures counts the failures of each destination that were tolerated by the policy.
+	Failures map[int]int
+}
+
+// Store knows how to store data into every destination.
+// The destinations are called one after the other, in order.
+func (m *MultiStorer) Store(d *Data) error {
+	var errs map[int]error
+	for i, s := range m.Storers {
+		if err := s.Store(d); err != nil {
+			if errs == nil {
+				errs = make(map[int]error)
+			}
+			errs[i] = err
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	succeeded := len(m.Storers) - len(errs)
+	if succeeded < m.Policy.required(len(m.Storers)) {
+		return &MultiError{
+			Policy:    m.Policy,
+			Succeeded: succeeded,
+			Errors:    errs,
+		}
+	}
+
+	if m.Failures == nil {
+		m.Failures = make(map[int]int)
+	}
+	for i := range errs {
+		m.Failures[i]++
+	}
+
+	return nil
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	ms := MultiStorer{
+		Storers: []Storer{
+			&Pillar{Host: "primary:9000", Timeout: time.Second},
+			&Pillar{Host: "audit:9001", Timeout: time.Second, FailRate: 0.2},
+			&Pillar{Host: "backup:9002", Timeout: time.Second, FailRate: 0.2},
+		},
+		Policy: Quorum,
+	}
+
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &ms,
+	}
+
+	err := Copy(&sys, 3)
+
+	// Copy doesn't know about MultiStorer, but the concrete error value it returns is still the
+	// one that MultiStorer created. We can get to it with errors.As.
+	var me *MultiError
+	switch {
+	case err == io.EOF:
+		fmt.Println("Copy complete")
+
+	case errors.As(err, &me):
+		for _, i := range me.Indexes() {
+			fmt.Printf("Destination %d failed: %v\n", i, me.Errors[i])
+		}
+
+	default:
+		fmt.Println(err)
+	}
+
+	fmt.Println("Tolerated failures by destination:", ms.Failures)
+}
@@ -0,0 +1,272 @@
+// -------------------------------
+// Decoupling With Transformations
+// -------------------------------
+
+// Copy moves Data from the Puller to the Storer exactly as it comes in. Every real job needs to do
+// something in the middle: clean up the line, drop the records we don't care about, add some
+// information about where the record came from.
+
+// We add a third behavior next to pulling and storing: transforming. A Transformer receives a
+// record it can change in place and reports if the record should be kept. A record that is not
+// kept is filtered out and never makes it to the Storer, so it is not counted as stored either.
+
+// Transformers are small and do one thing. We get bigger behavior by composing them. Chain is a
+// slice of Transformers that is itself a Transformer. It runs them in order and stops as soon as
+// one of them drops the record. Because Chain is just another Transformer, a chain can be part of
+// another chain.
+
+// TransformerFunc is the same trick as http.HandlerFunc. Any function with the right signature can
+// be converted into a Transformer without declaring a new type. All of the built in transformers
+// below are implemented that way.
+
+//   Xenia -pull-> Copy -> Trim -> Filter -> Upper -> Inject -> Copy -store-> Pillar
+//                        |<------------ Chain ------------->|
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line   string
+	Fields map[string]string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Transformer declares behavior for changing a record on its way to the Storer.
+// It returns false when the record should be dropped.
+type Transformer interface {
+	Transform(d *Data) (bool, error)
+}
+
+// TransformerFunc allows a function to be used as a Transformer.
+type TransformerFunc func(d *Data) (bool, error)
+
+// Transform calls f(d).
+func (f TransformerFunc) Transform(d *Data) (bool, error) {
+	return f(d)
+}
+
+// Chain is a Transformer that runs a list of Transformers in order.
+type Chain []Transformer
+
+// Transform runs every Transformer in the chain until one of them drops the record or fails.
+func (c Chain) Transform(d *Data) (bool, error) {
+	for _, t := range c {
+		keep, err := t.Transform(d)
+		if err != nil || !keep {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Trim removes leading and trailing white space from the line.
+func Trim() Transformer {
+	return TransformerFunc(func(d *Data) (bool, error) {
+		d.Line = strings.TrimSpace(d.Line)
+		return true, nil
+	})
+}
+
+// Upper maps the line to upper case.
+func Upper() Transformer {
+	return TransformerFunc(func(d *Data) (bool, error) {
+		d.Line = strings.ToUpper(d.Line)
+		return true, nil
+	})
+}
+
+// Filter keeps only the records whose line matches the regular expression.
+// When invert is true, it does the opposite and drops the records that match.
+func Filter(re *regexp.Regexp, invert bool) Transformer {
+	return TransformerFunc(func(d *Data) (bool, error) {
+		return re.MatchString(d.Line) != invert, nil
+	})
+}
+
+// Inject sets a field on every record.
+func Inject(key string, value string) Transformer {
+	return TransformerFunc(func(d *Data) (bool, error) {
+		if d.Fields == nil {
+			d.Fields = make(map[string]string)
+		}
+
+		d.Fields[key] = value
+		return true, nil
+	})
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// lines are the lines Xenia has to offer.
+var lines = []string{
+	"  data from xenia  ",
+	"debug: ping",
+	"\tmore data\n",
+	"debug: pong",
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1, 9:
+		return io.EOF
+
+	default:
+		d.Line = lines[rand.Intn(len(lines))]
+		d.Fields = nil
+		fmt.Printf("In: %q\n", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Printf("Out: %q %v\n", d.Line, d.Fields)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// transform knows how to transform bulks of data with any Transformer.
+// The records that are kept are moved to the front of the slice, in their original order, and the
+// number of them is returned.
+func transform(t Transformer, data []Data) (int, error) {
+	var kept int
+	for i := range data {
+		keep, err := t.Transform(&data[i])
+		if err != nil {
+			return kept, err
+		}
+
+		if keep {
+			data[kept], data[i] = data[i], data[kept]
+			kept++
+		}
+	}
+
+	return kept, nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull, transform and store data from any System.
+// It returns the number of records that were stored. Records dropped by the Transformer are not
+// part of that number. A nil Transformer keeps every record as it is.
+func Copy(ps PullStorer, t Transformer, batch int) (int, error) {
+	if t == nil {
+		t = Chain{}
+	}
+
+	data := make([]Data, batch)
+	var stored int
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			k, err := transform(t, data[:i])
+			if err != nil {
+				return stored, err
+			}
+
+			n, err := store(ps, data[:k])
+			stored += n
+			if err != nil {
+				return stored, err
+			}
+		}
+
+		if err != nil {
+			return stored, err
+		}
+	}
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	chain := Chain{
+		Trim(),
+		Filter(regexp.MustCompile(`^debug:`), true),
+		Upper(),
+		Inject("source", "xenia"),
+	}
+
+	n, err := Copy(&sys, chain, 3)
+	if err != io.EOF {
+		fmt.Println(err)
+	}
+
+	fmt.Println("Stored:", n)
+}
@@ -0,0 +1,275 @@
+// ----------------------------
+// Decoupling With Dead Letters
+// ----------------------------
+
+// store() stops at the first record that fails and Copy aborts the whole job. One bad record out of
+// a million and nothing else gets copied.
+
+// A common answer to this is a dead letter sink. A record that can't be stored, even after a few
+// attempts, is set aside into another Storer and Copy keeps going with the next record. Later on,
+// someone can look at what ended up there, fix the problem and replay it.
+
+// The dead letter sink is just a Storer, so anything we already have can play that role: a file,
+// another Pillar, a MultiStorer. But a plain Storer only receives the Data, it has no idea why the
+// record ended up there. So we ask for more behavior, when it is available. If the sink also
+// implements DeadLetterer, Copy hands it the error and the number of attempts together with the
+// record. This is the same idea as asking an error if it is temporary: we don't care what the
+// concrete type is, only if it can do what we need.
+
+// At the end, Copy returns a Report with the number of records stored and dead lettered, grouped
+// by the reason they failed.
+
+//                                   ok
+//   Xenia -pull-> Copy -store-> Pillar
+//                          |
+//                          | failed, attempts used up
+//                          v
+//                     DeadLetters (record + error + attempts)
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// DeadLetterer declares behavior for storing a record that failed along with why it failed.
+type DeadLetterer interface {
+	StoreDeadLetter(d *Data, err error, attempts int) error
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	n       int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	if rand.Intn(20) == 1 {
+		return io.EOF
+	}
+
+	x.n++
+	d.Line = fmt.Sprintf("Data %d", x.n)
+	fmt.Println("In:", d.Line)
+	return nil
+}
+
+// Set of errors Pillar can return.
+var (
+	ErrTooLarge = errors.New("record too large")
+	ErrTimeout  = errors.New("timed out")
+)
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	switch rand.Intn(10) {
+	case 1:
+		return ErrTooLarge
+
+	case 2, 3:
+		return ErrTimeout
+
+	default:
+		fmt.Println("Out:", d.Line)
+		return nil
+	}
+}
+
+// DeadLetter is a record that could not be stored.
+type DeadLetter struct {
+	Data     Data
+	Err      error
+	Attempts int
+}
+
+// DeadLetters is a dead letter sink that keeps the records in memory.
+type DeadLetters struct {
+	Letters []DeadLetter
+}
+
+// Store knows how to store data that failed without knowing why.
+func (dl *DeadLetters) Store(d *Data) error {
+	return dl.StoreDeadLetter(d, nil, 0)
+}
+
+// StoreDeadLetter knows how to store data that failed along with why it failed.
+func (dl *DeadLetters) StoreDeadLetter(d *Data, err error, attempts int) error {
+	fmt.Printf("Dead: %s (%v after %d attempts)\n", d.Line, err, attempts)
+	dl.Letters = append(dl.Letters, DeadLetter{
+		Data:     *d,
+		Err:      err,
+		Attempts: attempts,
+	})
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Report describes the outcome of a copy.
+type Report struct {
+	Stored       int
+	DeadLettered int
+	Reasons      map[string]int // number of dead letters by error message
+}
+
+// String returns a readable summary of the report.
+func (r Report) String() string {
+	s := fmt.Sprintf("stored: %d dead lettered: %d", r.Stored, r.DeadLettered)
+
+	reasons := make([]string, 0, len(r.Reasons))
+	for reason := range r.Reasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	for _, reason := range reasons {
+		s += fmt.Sprintf("\n  %d x %s", r.Reasons[reason], reason)
+	}
+
+	return s
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+// Every record gets up to attempts tries. A record that still fails is handed to the dead letter
+// sink and we move on to the next one. Only a missing dead letter sink or a failure of the sink
+// itself stops the batch, since there is nowhere left to put the record.
+func store(s Storer, dead Storer, attempts int, data []Data, r *Report) error {
+	for i := range data {
+		var err error
+		var n int
+		for n < attempts {
+			n++
+			if err = s.Store(&data[i]); err == nil {
+				break
+			}
+		}
+
+		if err == nil {
+			r.Stored++
+			continue
+		}
+
+		// Without a dead letter sink there is nowhere to put the record, so we stop like before.
+		if dead == nil {
+			return err
+		}
+
+		if dl, ok := dead.(DeadLetterer); ok {
+			if err := dl.StoreDeadLetter(&data[i], err, n); err != nil {
+				return err
+			}
+		} else {
+			if err := dead.Store(&data[i]); err != nil {
+				return err
+			}
+		}
+
+		r.DeadLettered++
+		r.Reasons[err.Error()]++
+	}
+
+	return nil
+}
+
+// Copy knows how to pull and store data from any System. Records that fail to store after the
+// given number of attempts go to the dead letter sink instead of stopping the copy. A nil dead
+// letter sink makes Copy stop at the first record that fails, the way it did before.
+func Copy(ps PullStorer, dead Storer, attempts int, batch int) (Report, error) {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	r := Report{
+		Reasons: make(map[string]int),
+	}
+
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if err := store(ps, dead, attempts, data[:i], &r); err != nil {
+				return r, err
+			}
+		}
+
+		if err != nil {
+			return r, err
+		}
+	}
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	var dead DeadLetters
+
+	r, err := Copy(&sys, &dead, 2, 3)
+	if err != io.EOF {
+		fmt.Println(err)
+	}
+
+	fmt.Println(r)
+}
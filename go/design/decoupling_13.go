@@ -0,0 +1,266 @@
+// -------------------------------
+// Decoupling With Fault Injection
+// -------------------------------
+
+// Xenia seeds the global random source with the time in init() and decides what happens with a
+// hard coded switch: 1 and 9 are EOF, 5 is an error. Every run is different. That is fine for a
+// demo but we can't write a test for Copy's error paths on top of that, and when something goes
+// wrong we can't run it again to see what happened.
+
+// Faulty is a system that injects faults on purpose, but in a way we control:
+// - It has its own random source, created from an explicit Seed. The same seed always produces the
+// same sequence of calls. Nothing touches the global source.
+// - The probabilities are configuration, not code: EOFRate and ErrorRate.
+// - The time a call takes comes from a Latency, which is an interface. We provide a fixed and a
+// uniform distribution, anything else only needs another type.
+// - Script lets us say exactly what the first calls do, for the cases where probabilities are not
+// precise enough: "succeed twice, then fail, then end".
+// - Waiting goes through a Clock, like in the retry example, so a test doesn't actually sleep.
+
+// Faulty implements both Puller and Storer, so it can stand in on either side of Copy.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// ErrInjected is returned when Faulty decides a call fails.
+var ErrInjected = errors.New("injected fault")
+
+// Clock declares behavior for waiting.
+type Clock interface {
+	Sleep(d time.Duration)
+}
+
+// realClock waits using the real time.
+type realClock struct{}
+
+// Sleep pauses the current Goroutine for at least the duration d.
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Latency declares behavior for deciding how long a call takes.
+type Latency interface {
+	Next(r *rand.Rand) time.Duration
+}
+
+// Fixed is a Latency where every call takes the same time.
+type Fixed time.Duration
+
+// Next returns the fixed duration.
+func (f Fixed) Next(*rand.Rand) time.Duration {
+	return time.Duration(f)
+}
+
+// Uniform is a Latency where every call takes between Min and Max.
+type Uniform struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// Next returns a duration in [Min, Max).
+func (u Uniform) Next(r *rand.Rand) time.Duration {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+
+	return u.Min + time.Duration(r.Int63n(int64(u.Max-u.Min)))
+}
+
+// Faulty is a system that fails in a configurable and reproducible way.
+type Faulty struct {
+	Seed      int64
+	EOFRate   float64 // probability between 0 and 1 that a call returns io.EOF
+	ErrorRate float64 // probability between 0 and 1 that a call returns ErrInjected
+	Latency   Latency // nil means calls take no time
+	Clock     Clock   // nil means the real time
+
+	// Script decides the outcome of the first calls, one entry per call. A nil entry is a call that
+	// succeeds. Once the script is used up, the rates take over.
+	Script []error
+
+	rand  *rand.Rand
+	calls int
+	n     int
+}
+
+// next decides the outcome of the next call.
+func (f *Faulty) next() error {
+	if f.rand == nil {
+		f.rand = rand.New(rand.NewSource(f.Seed))
+	}
+
+	call := f.calls
+	f.calls++
+
+	// The latency is taken from the source on every call, scripted or not. This keeps the rest of
+	// the sequence the same when we add or remove a scripted entry.
+	if f.Latency != nil {
+		clock := f.Clock
+		if clock == nil {
+			clock = realClock{}
+		}
+		clock.Sleep(f.Latency.Next(f.rand))
+	}
+
+	roll := f.rand.Float64()
+
+	if call < len(f.Script) {
+		return f.Script[call]
+	}
+
+	switch {
+	case roll < f.EOFRate:
+		return io.EOF
+	case roll < f.EOFRate+f.ErrorRate:
+		return ErrInjected
+	}
+
+	return nil
+}
+
+// Pull knows how to pull data out of Faulty.
+func (f *Faulty) Pull(d *Data) error {
+	if err := f.next(); err != nil {
+		return err
+	}
+
+	f.n++
+	d.Line = fmt.Sprintf("Data %d", f.n)
+	return nil
+}
+
+// Store knows how to store data into Faulty.
+func (f *Faulty) Store(d *Data) error {
+	if err := f.next(); err != nil {
+		return err
+	}
+
+	f.n++
+	return nil
+}
+
+// Calls returns the number of calls made so far.
+func (f *Faulty) Calls() int {
+	return f.calls
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// fakeClock is a Clock that doesn't wait. It only adds up how long it was asked to wait.
+type fakeClock struct {
+	elapsed time.Duration
+}
+
+// Sleep records the duration d without waiting.
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.elapsed += d
+}
+
+// run copies between two Faulty systems and reports what happened.
+func run(src *Faulty, dst *Faulty) {
+	err := Copy(&System{Puller: src, Storer: dst}, 3)
+	fmt.Printf("err: %v pulls: %d stores: %d\n", err, src.Calls(), dst.Calls())
+}
+
+func main() {
+	// The same seed gives the same run, every time.
+	for i := 0; i < 2; i++ {
+		var clock fakeClock
+		src := Faulty{
+			Seed:      1,
+			EOFRate:   0.05,
+			ErrorRate: 0.02,
+			Latency:   Uniform{Min: time.Millisecond, Max: 10 * time.Millisecond},
+			Clock:     &clock,
+		}
+		dst := Faulty{
+			Seed:      7,
+			ErrorRate: 0.02,
+			Latency:   Fixed(2 * time.Millisecond),
+			Clock:     &clock,
+		}
+
+		run(&src, &dst)
+		fmt.Println("simulated time:", clock.elapsed)
+	}
+
+	// A script gives us an exact error path: the store fails on the fourth record.
+	src := Faulty{Seed: 1}
+	dst := Faulty{
+		Seed:   1,
+		Script: []error{nil, nil, nil, ErrInjected},
+	}
+	run(&src, &dst)
+}
@@ -0,0 +1,373 @@
+// -----------------------------
+// Decoupling With Observability
+// -----------------------------
+
+// Copy returns an error and nothing else. When a copy job is slow, or stores fewer records than we
+// expected, we have nothing to look at. We want counts, throughput and latency so we can log them
+// and alert on them.
+
+// There are two parts to this:
+// - An Observer interface that Copy notifies on every pull, every store, every batch boundary and
+// every error that ends the copy. Copy doesn't know what the observer does with it. It could log,
+// publish metrics or ignore everything.
+// - A Stats value that Copy returns. Stats is itself an Observer. Copy always feeds one, so every
+// caller gets the numbers without doing anything, and can still plug in their own Observer next
+// to it.
+
+// Latency is recorded in a Histogram with exponential buckets: under 1µs, under 2µs, under 4µs and
+// so on. That is cheap to record, a fixed amount of memory no matter how many calls we make, and
+// precise enough to answer "what is the p99 latency of Store?".
+
+//                      OnPull/OnStore/OnBatch/OnError
+//   Xenia -pull-> Copy ------------------------> Stats
+//                  |                         --> Observer (log, metrics...)
+//                  -store-> Pillar
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Observer declares behavior for being notified of what Copy is doing.
+type Observer interface {
+	OnPull(took time.Duration, err error)
+	OnStore(took time.Duration, err error)
+	OnBatch(n int)
+	OnError(err error)
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	time.Sleep(time.Duration(rand.Intn(1000)) * time.Microsecond)
+
+	switch rand.Intn(30) {
+	case 1:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		d.Line = "Data"
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	time.Sleep(time.Duration(rand.Intn(5000)) * time.Microsecond)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// buckets is the number of buckets in a Histogram. The last bucket holds everything from
+// 2^(buckets-2)µs up, which is a little over a minute.
+const buckets = 28
+
+// Histogram counts durations in buckets that double in size.
+// Bucket 0 counts everything under 1µs, bucket i counts everything under 2^i µs.
+type Histogram struct {
+	Counts [buckets]int
+	Total  int
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+// Observe records a single duration.
+func (h *Histogram) Observe(d time.Duration) {
+	i := 0
+	for limit := time.Microsecond; d >= limit && i < buckets-1; limit *= 2 {
+		i++
+	}
+
+	h.Counts[i]++
+	h.Total++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// Mean returns the average duration.
+func (h *Histogram) Mean() time.Duration {
+	if h.Total == 0 {
+		return 0
+	}
+
+	return h.Sum / time.Duration(h.Total)
+}
+
+// Quantile returns the upper bound of the bucket that holds the q quantile, with q between 0 and
+// 1. The real value is somewhere between half of that and that.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.Total == 0 {
+		return 0
+	}
+
+	rank := int(q*float64(h.Total) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int
+	limit := time.Microsecond
+	for i := 0; i < buckets; i++ {
+		seen += h.Counts[i]
+		if seen >= rank {
+			break
+		}
+		limit *= 2
+	}
+
+	if limit > h.Max {
+		return h.Max
+	}
+
+	return limit
+}
+
+// String returns a short summary of the histogram.
+func (h *Histogram) String() string {
+	return fmt.Sprintf("n=%d mean=%v p50=%v p99=%v max=%v",
+		h.Total, h.Mean(), h.Quantile(0.5), h.Quantile(0.99), h.Max)
+}
+
+// Stats describes what happened during a copy. It is an Observer so Copy can fill it in.
+type Stats struct {
+	Pulled       int
+	Stored       int
+	Batches      int
+	PullLatency  Histogram
+	StoreLatency Histogram
+	Err          error
+	Start        time.Time
+	End          time.Time
+}
+
+// OnPull records a call to Pull.
+func (s *Stats) OnPull(took time.Duration, err error) {
+	s.PullLatency.Observe(took)
+	if err == nil {
+		s.Pulled++
+	}
+}
+
+// OnStore records a call to Store.
+func (s *Stats) OnStore(took time.Duration, err error) {
+	s.StoreLatency.Observe(took)
+	if err == nil {
+		s.Stored++
+	}
+}
+
+// OnBatch records the end of a batch.
+func (s *Stats) OnBatch(n int) {
+	s.Batches++
+}
+
+// OnError records the error that ended the copy.
+func (s *Stats) OnError(err error) {
+	s.Err = err
+}
+
+// Elapsed returns how long the copy took.
+func (s *Stats) Elapsed() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Throughput returns the number of records stored per second.
+func (s *Stats) Throughput() float64 {
+	secs := s.Elapsed().Seconds()
+	if secs == 0 {
+		return 0
+	}
+
+	return float64(s.Stored) / secs
+}
+
+// String returns a readable summary of the stats.
+func (s *Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pulled: %d stored: %d batches: %d elapsed: %v throughput: %.1f/s\n",
+		s.Pulled, s.Stored, s.Batches, s.Elapsed(), s.Throughput())
+	fmt.Fprintf(&b, "pull:  %v\n", &s.PullLatency)
+	fmt.Fprintf(&b, "store: %v", &s.StoreLatency)
+	return b.String()
+}
+
+// observers is an Observer that notifies a list of Observers.
+type observers []Observer
+
+// OnPull notifies every observer of a call to Pull.
+func (o observers) OnPull(took time.Duration, err error) {
+	for _, ob := range o {
+		ob.OnPull(took, err)
+	}
+}
+
+// OnStore notifies every observer of a call to Store.
+func (o observers) OnStore(took time.Duration, err error) {
+	for _, ob := range o {
+		ob.OnStore(took, err)
+	}
+}
+
+// OnBatch notifies every observer of the end of a batch.
+func (o observers) OnBatch(n int) {
+	for _, ob := range o {
+		ob.OnBatch(n)
+	}
+}
+
+// OnError notifies every observer of the error that ended the copy.
+func (o observers) OnError(err error) {
+	for _, ob := range o {
+		ob.OnError(err)
+	}
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data, ob Observer) (int, error) {
+	for i := range data {
+		start := time.Now()
+		err := p.Pull(&data[i])
+		ob.OnPull(time.Since(start), err)
+
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data, ob Observer) (int, error) {
+	for i := range data {
+		start := time.Now()
+		err := s.Store(&data[i])
+		ob.OnStore(time.Since(start), err)
+
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+// It always returns the Stats of the copy. Any extra Observers are notified along with it.
+func Copy(ps PullStorer, batch int, obs ...Observer) (*Stats, error) {
+	stats := Stats{
+		Start: time.Now(),
+	}
+
+	ob := append(observers{&stats}, obs...)
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data, ob)
+		if i > 0 {
+			n, err := store(ps, data[:i], ob)
+			ob.OnBatch(n)
+
+			if err != nil {
+				ob.OnError(err)
+				stats.End = time.Now()
+				return &stats, err
+			}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				ob.OnError(err)
+			}
+			stats.End = time.Now()
+			return &stats, err
+		}
+	}
+}
+
+// logObserver is an Observer that logs batches and errors.
+type logObserver struct{}
+
+// OnPull is ignored, logging every call would be too much noise.
+func (logObserver) OnPull(time.Duration, error) {}
+
+// OnStore is ignored, logging every call would be too much noise.
+func (logObserver) OnStore(time.Duration, error) {}
+
+// OnBatch logs the end of a batch.
+func (logObserver) OnBatch(n int) {
+	fmt.Println("batch stored:", n)
+}
+
+// OnError logs the error that ended the copy.
+func (logObserver) OnError(err error) {
+	fmt.Println("copy failed:", err)
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	stats, _ := Copy(&sys, 5, logObserver{})
+	fmt.Println(stats)
+}
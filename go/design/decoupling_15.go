@@ -0,0 +1,258 @@
+// ----------------------------
+// Decoupling With Flush Timers
+// ----------------------------
+
+// pull() only comes back when the batch is full or Pull fails. When the source is slow, say one
+// record every few seconds, the first records of a batch sit in memory for a long time before they
+// are stored. If the process dies in the meantime, they are lost.
+
+// We want Copy to flush a batch on whichever comes first: the batch is full or the oldest record in
+// the batch has been waiting for MaxWait.
+
+// The problem is that Pull blocks. While we are inside Pull, we can't also be watching a timer. So
+// we move pulling into its own Goroutine that sends every record on a channel. Copy can now select
+// on two things at the same time: the next record and the timer. The timer starts when the first
+// record of a batch arrives, which is exactly how long that record has been waiting.
+
+// The timer comes from a Clock interface with a single method, After, with the same signature as
+// time.After. The real Clock calls time.After. A test can use a Clock that returns a channel it
+// controls and fire it whenever it wants, so no test ever has to wait for real time to pass.
+// decoupling_15_test.go does exactly that:
+//   go test -v decoupling_15.go decoupling_15_test.go
+
+//                  records                 size reached
+//   puller G -----------------> Copy ------------------> store
+//                                ^   \--- MaxWait ----->
+//                                |
+//                           Clock.After
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Clock declares behavior for being told when time has passed.
+type Clock interface {
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock uses the real time.
+type realClock struct{}
+
+// After waits for the duration to elapse and then sends the current time on the returned channel.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Xenia is a system we need to pull data from.
+// It is a slow system: every record takes up to 200ms to come in.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	n       int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Millisecond)
+
+	switch rand.Intn(20) {
+	case 1:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		x.n++
+		d.Line = fmt.Sprintf("Data %d", x.n)
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Flush decides when a batch is stored.
+type Flush struct {
+	Size    int           // Store once the batch has this many records.
+	MaxWait time.Duration // Store once the oldest record has waited this long. Zero means never.
+	Clock   Clock         // nil means the real time.
+
+	// OnFlush, if set, is called with the size of every batch and the reason it is stored:
+	// "size", "max wait" or "end of pull".
+	OnFlush func(n int, reason string)
+}
+
+// record is a pulled record, or the error that ended the pulling.
+type record struct {
+	data Data
+	err  error
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+// A batch is stored as soon as it is full or its oldest record has waited for MaxWait.
+func Copy(ps PullStorer, f Flush) error {
+	clock := f.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	// done tells the puller Goroutine to stop when Copy returns early because of a failed store.
+	// The puller finishes the Pull it is in, if any, and then gets out.
+	records := make(chan record)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			var r record
+			r.err = ps.Pull(&r.data)
+
+			select {
+			case records <- r:
+			case <-done:
+				return
+			}
+
+			if r.err != nil {
+				return
+			}
+		}
+	}()
+
+	size := f.Size
+	if size < 1 {
+		size = 1
+	}
+
+	data := make([]Data, 0, size)
+
+	// A nil channel blocks forever in a select. That is how the timer case is turned off while
+	// the batch is empty.
+	var timer <-chan time.Time
+
+	flush := func(reason string) error {
+		if len(data) == 0 {
+			return nil
+		}
+
+		if f.OnFlush != nil {
+			f.OnFlush(len(data), reason)
+		}
+		_, err := store(ps, data)
+		data = data[:0]
+		timer = nil
+		return err
+	}
+
+	for {
+		select {
+		case r := <-records:
+			if r.err != nil {
+				if err := flush("end of pull"); err != nil {
+					return err
+				}
+				return r.err
+			}
+
+			data = append(data, r.data)
+			if len(data) == 1 && f.MaxWait > 0 {
+				timer = clock.After(f.MaxWait)
+			}
+
+			if len(data) == size {
+				if err := flush("size"); err != nil {
+					return err
+				}
+			}
+
+		case <-timer:
+			if err := flush("max wait"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	f := Flush{
+		Size:    5,
+		MaxWait: 300 * time.Millisecond,
+		OnFlush: func(n int, reason string) {
+			fmt.Printf("Flush: %d records, %s\n", n, reason)
+		},
+	}
+
+	if err := Copy(&sys, f); err != io.EOF {
+		fmt.Println(err)
+	}
+}
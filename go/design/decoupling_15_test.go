@@ -0,0 +1,163 @@
+// -----------------
+// Flush timers test
+// -----------------
+
+// Run test using "go test -v decoupling_15.go decoupling_15_test.go"
+
+// The test drives the Clock by hand. Nothing here waits for real time to pass, a batch is flushed
+// for its max wait only when the test fires the timer.
+
+package main
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// fakeClock hands every timer Copy asks for to the test.
+type fakeClock struct {
+	timers chan chan time.Time
+}
+
+// After returns a channel that only fires when the test sends on it.
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	timer := make(chan time.Time, 1)
+	c.timers <- timer
+	return timer
+}
+
+// feed is a Puller that returns the lines the test sends, and io.EOF once the channel is closed.
+type feed chan string
+
+// Pull returns the next line sent by the test.
+func (f feed) Pull(d *Data) error {
+	line, ok := <-f
+	if !ok {
+		return io.EOF
+	}
+
+	d.Line = line
+	return nil
+}
+
+// sink is a Storer that keeps everything it is given.
+type sink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// Store keeps the line of the record.
+func (s *sink) Store(d *Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lines = append(s.lines, d.Line)
+	return nil
+}
+
+// Len returns the number of records stored.
+func (s *sink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.lines)
+}
+
+// flushed is a call to OnFlush.
+type flushed struct {
+	n      int
+	reason string
+}
+
+// TestFlush validates that a batch is stored when it is full and when its oldest record has waited
+// for MaxWait.
+func TestFlush(t *testing.T) {
+	in := make(feed)
+	out := sink{}
+	clock := fakeClock{timers: make(chan chan time.Time, 10)}
+	flushes := make(chan flushed)
+
+	f := Flush{
+		Size:    3,
+		MaxWait: time.Minute,
+		Clock:   &clock,
+		OnFlush: func(n int, reason string) {
+			flushes <- flushed{n, reason}
+		},
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- Copy(&System{Puller: in, Storer: &out}, f)
+	}()
+
+	expect := func(want flushed, stored int, should string) {
+		select {
+		case got := <-flushes:
+			if got != want {
+				t.Fatalf("\t%s\t%s : got %+v want %+v", failed, should, got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("\t%s\t%s : no flush", failed, should)
+		}
+
+		// OnFlush is called before the batch is stored, so the store may still be going on.
+		for i := 0; out.Len() != stored; i++ {
+			if i == 100 {
+				t.Fatalf("\t%s\t%s : stored %d want %d", failed, should, out.Len(), stored)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Logf("\t%s\t%s.", succeed, should)
+	}
+
+	t.Log("Given the need to store batches on time.")
+	{
+		t.Logf("\tTest 0:\tWhen the batch is full.")
+		{
+			in <- "1"
+			in <- "2"
+			in <- "3"
+			expect(flushed{3, "size"}, 3, "Should store the batch without waiting")
+
+			// The timer of the first batch was never fired, it doesn't matter anymore.
+			<-clock.timers
+		}
+
+		t.Logf("\tTest 1:\tWhen the oldest record waited for MaxWait.")
+		{
+			in <- "4"
+
+			var timer chan time.Time
+			select {
+			case timer = <-clock.timers:
+				t.Logf("\t%s\tShould start the timer on the first record.", succeed)
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tShould start the timer on the first record.", failed)
+			}
+
+			timer <- time.Now()
+			expect(flushed{1, "max wait"}, 4, "Should store the batch when the timer fires")
+		}
+
+		t.Logf("\tTest 2:\tWhen the puller is done.")
+		{
+			in <- "5"
+			<-clock.timers
+			close(in)
+			expect(flushed{1, "end of pull"}, 5, "Should store what is left")
+
+			if err := <-done; err != io.EOF {
+				t.Fatalf("\t%s\tShould return io.EOF : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return io.EOF.", succeed)
+		}
+	}
+}
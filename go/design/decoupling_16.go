@@ -0,0 +1,388 @@
+// -----------------------------
+// Decoupling With Rate Limiting
+// -----------------------------
+
+// Copy calls Store as fast as Pull gives it records. Our downstream stores throttle us when we do
+// that, and a throttled store is usually slower than a store we never overloaded in the first
+// place.
+
+// A token bucket is the classic answer. The bucket holds up to Burst tokens and is refilled at Rate
+// tokens per second. Every call takes a token. When the bucket is empty, the call waits until a
+// token has been refilled. Burst lets a quiet client do a few calls back to back, Rate is what it
+// gets over the long run.
+
+// Rate limiting is one more decorator, like retrying. LimitedPuller stores a ContextPuller and
+// LimitedStorer stores a ContextStorer. Before delegating, they wait on the Limiter. We build on
+// the context aware interfaces from decoupling_5.go because waiting is blocking, and a Copy that is
+// waiting for a token must still be cancellable. The Limiter selects on ctx.Done() next to the
+// timer, so cancelling the context ends the wait right away and hands back the token it reserved.
+
+// Any plain Puller or Storer can be limited too. The adapters from decoupling_5.go, split in two
+// here, turn a Puller into a ContextPuller and a Storer into a ContextStorer. Xenia below is a
+// plain Puller, the same as in decoupling_4.go.
+
+// Some systems limit calls, others limit batches. A decorator only sees single calls, it can't
+// tell where a batch starts. CopyContext can, so the batch limits are given to it instead:
+// BatchLimits takes one token from the Pull Limiter before every batch it pulls and one from the
+// Store Limiter before every batch it stores, whatever the size of the batch.
+
+// Time comes from a Clock so a test can move time forward by hand. decoupling_16_test.go does
+// that for the limits per batch and for a wait that is cancelled:
+//   go test -v decoupling_16.go decoupling_16_test.go
+
+//   Copy -pull-> LimitedPuller -wait-> Limiter       Copy -store-> LimitedStorer -wait-> Limiter
+//                     |                                                 |
+//                   Xenia                                            Pillar
+//
+//   Copy -every batch-> BatchLimits.Pull or BatchLimits.Store -wait-> Limiter
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// ContextPuller declares behavior for pulling data that can be cancelled.
+type ContextPuller interface {
+	PullContext(ctx context.Context, d *Data) error
+}
+
+// ContextStorer declares behavior for storing data that can be cancelled.
+type ContextStorer interface {
+	StoreContext(ctx context.Context, d *Data) error
+}
+
+// ContextPullStorer declares behaviors for both pulling and storing with cancellation.
+type ContextPullStorer interface {
+	ContextPuller
+	ContextStorer
+}
+
+// pullAdapter allows any Puller to be used as a ContextPuller.
+type pullAdapter struct {
+	p Puller
+}
+
+// PullerContext returns a ContextPuller that checks for cancellation before every call into the
+// Puller. The Puller itself doesn't need to know anything about the context.
+func PullerContext(p Puller) ContextPuller {
+	return &pullAdapter{p: p}
+}
+
+// PullContext knows how to pull data out of the Puller unless the context is done.
+func (a *pullAdapter) PullContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.p.Pull(d)
+}
+
+// storeAdapter allows any Storer to be used as a ContextStorer.
+type storeAdapter struct {
+	s Storer
+}
+
+// StorerContext returns a ContextStorer that checks for cancellation before every call into the
+// Storer. The Storer itself doesn't need to know anything about the context.
+func StorerContext(s Storer) ContextStorer {
+	return &storeAdapter{s: s}
+}
+
+// StoreContext knows how to store data into the Storer unless the context is done.
+func (a *storeAdapter) StoreContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.s.Store(d)
+}
+
+// WithContext returns a ContextPullStorer for any PullStorer, like in decoupling_5.go.
+func WithContext(ps PullStorer) ContextPullStorer {
+	return &System{
+		ContextPuller: PullerContext(ps),
+		ContextStorer: StorerContext(ps),
+	}
+}
+
+// Clock declares behavior for telling and waiting for time.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock uses the real time.
+type realClock struct{}
+
+// Now returns the current time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// After waits for the duration to elapse and then sends the current time on the returned channel.
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Limiter is a token bucket.
+type Limiter struct {
+	Rate  float64 // tokens refilled per second, zero means no limit
+	Burst int     // size of the bucket
+	Clock Clock   // nil means the real time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// clock returns the Clock of the Limiter.
+func (l *Limiter) clock() Clock {
+	if l.Clock == nil {
+		return realClock{}
+	}
+
+	return l.Clock
+}
+
+// reserve takes n tokens from the bucket and returns how long to wait until they are really
+// there. The bucket may go negative, which is how later callers learn they have to wait longer.
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock().Now()
+	if l.last.IsZero() {
+		l.tokens = float64(l.Burst)
+	} else {
+		l.tokens += now.Sub(l.last).Seconds() * l.Rate
+		l.tokens = math.Min(l.tokens, float64(l.Burst))
+	}
+	l.last = now
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-l.tokens / l.Rate * float64(time.Second))
+}
+
+// cancel gives n tokens back to the bucket.
+func (l *Limiter) cancel(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens += float64(n)
+}
+
+// Wait blocks until n tokens are available or the context is done.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l.Rate <= 0 {
+		return ctx.Err()
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	wait := l.reserve(n)
+	if wait == 0 {
+		return nil
+	}
+
+	select {
+	case <-l.clock().After(wait):
+		return nil
+
+	case <-ctx.Done():
+		l.cancel(n)
+		return ctx.Err()
+	}
+}
+
+// LimitedPuller is a ContextPuller that is rate limited, one token per call.
+type LimitedPuller struct {
+	Puller  ContextPuller
+	Limiter *Limiter
+}
+
+// PullContext knows how to pull data out of the inner Puller once the Limiter allows it.
+func (lp *LimitedPuller) PullContext(ctx context.Context, d *Data) error {
+	if err := lp.Limiter.Wait(ctx, 1); err != nil {
+		return err
+	}
+
+	return lp.Puller.PullContext(ctx, d)
+}
+
+// LimitedStorer is a ContextStorer that is rate limited, one token per call.
+type LimitedStorer struct {
+	Storer  ContextStorer
+	Limiter *Limiter
+}
+
+// StoreContext knows how to store data into the inner Storer once the Limiter allows it.
+func (ls *LimitedStorer) StoreContext(ctx context.Context, d *Data) error {
+	if err := ls.Limiter.Wait(ctx, 1); err != nil {
+		return err
+	}
+
+	return ls.Storer.StoreContext(ctx, d)
+}
+
+// BatchLimits are the limits of a copy that count batches instead of calls.
+type BatchLimits struct {
+	Pull  *Limiter // one token before every batch that is pulled, nil means no limit
+	Store *Limiter // one token before every batch that is stored, nil means no limit
+}
+
+// wait takes a token from l, if there is a Limiter.
+func wait(ctx context.Context, l *Limiter) error {
+	if l == nil {
+		return nil
+	}
+
+	return l.Wait(ctx, 1)
+}
+
+// Xenia is a system we need to pull data from. It never runs out of data.
+// It is a plain Puller that knows nothing about contexts.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	n       int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	x.n++
+	d.Line = fmt.Sprintf("Data %d", x.n)
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+	start   time.Time
+}
+
+// StoreContext knows how to store data into Pillar.
+func (p *Pillar) StoreContext(ctx context.Context, d *Data) error {
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+
+	fmt.Printf("Out: %-8s at %v\n", d.Line, time.Since(p.start).Round(time.Millisecond))
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	ContextPuller
+	ContextStorer
+}
+
+// pullContext knows how to pull bulks of data from any ContextPuller.
+func pullContext(ctx context.Context, p ContextPuller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.PullContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// storeContext knows how to store bulks of data from any ContextStorer.
+func storeContext(ctx context.Context, s ContextStorer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.StoreContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// CopyContext knows how to pull and store data from any System until the context is done.
+// Every batch waits for the BatchLimits first, a short batch counts as a whole one.
+func CopyContext(ctx context.Context, ps ContextPullStorer, batch int, limits BatchLimits) (int, error) {
+	data := make([]Data, batch)
+	var stored int
+
+	for {
+		if err := wait(ctx, limits.Pull); err != nil {
+			return stored, err
+		}
+
+		i, err := pullContext(ctx, ps, data)
+		if i > 0 {
+			if err := wait(ctx, limits.Store); err != nil {
+				return stored, err
+			}
+
+			n, err := storeContext(ctx, ps, data[:i])
+			stored += n
+			if err != nil {
+				return stored, err
+			}
+		}
+
+		if err != nil {
+			return stored, err
+		}
+	}
+}
+
+func main() {
+	const batch = 4
+
+	sys := System{
+		ContextPuller: PullerContext(&Xenia{Host: "localhost:8000", Timeout: time.Second}),
+
+		// Pillar allows 5 records per second, with 3 back to back.
+		ContextStorer: &LimitedStorer{
+			Storer:  &Pillar{Host: "localhost:9000", Timeout: time.Second},
+			Limiter: &Limiter{Rate: 5, Burst: 3},
+		},
+	}
+
+	// Xenia never runs out, so the only way this copy ends is the timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// Xenia allows 2 batches per second.
+	limits := BatchLimits{
+		Pull: &Limiter{Rate: 2, Burst: 1},
+	}
+
+	n, err := CopyContext(ctx, &sys, batch, limits)
+	fmt.Println("Stored:", n, "Err:", err)
+}
@@ -0,0 +1,188 @@
+// ------------------
+// Rate limiting test
+// ------------------
+
+// Run test using "go test -v decoupling_16.go decoupling_16_test.go"
+
+// The Limiter never sees the real time here. The fake Clock tells the time the test sets and
+// keeps track of every wait it is asked for.
+
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// fakeClock is a Clock the test moves by hand.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waited time.Duration // sum of every wait asked for
+	block  bool          // After never fires, only a cancelled context ends the wait
+	waits  chan time.Duration
+}
+
+// newFakeClock returns a clock at a fixed time.
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		waits: make(chan time.Duration, 100),
+	}
+}
+
+// Now returns the time the test set.
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// After moves the time forward by d and fires right away, unless the clock blocks.
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.waits <- d
+	if c.block {
+		return nil
+	}
+
+	c.now = c.now.Add(d)
+	c.waited += d
+
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+// Advance moves the time forward by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Waited returns the sum of every wait.
+func (c *fakeClock) Waited() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.waited
+}
+
+// lines is a Puller with a fixed number of records.
+type lines struct {
+	n int
+}
+
+// Pull returns io.EOF once the records run out.
+func (l *lines) Pull(d *Data) error {
+	if l.n == 0 {
+		return io.EOF
+	}
+
+	l.n--
+	d.Line = "data"
+	return nil
+}
+
+// discard is a Storer that keeps nothing.
+type discard struct{}
+
+// Store throws the record away.
+func (discard) Store(d *Data) error {
+	return nil
+}
+
+// TestBatchLimits validates that a copy takes one token per batch, not per record.
+func TestBatchLimits(t *testing.T) {
+	t.Log("Given the need to limit a copy by batches.")
+	{
+		t.Logf("\tTest 0:\tWhen copying 5 records in batches of 2 at 1 batch per second.")
+		{
+			clock := newFakeClock()
+			limits := BatchLimits{
+				Pull:  &Limiter{Rate: 1, Burst: 1, Clock: clock},
+				Store: &Limiter{Rate: 1, Burst: 1, Clock: clock},
+			}
+
+			sys := System{
+				ContextPuller: PullerContext(&lines{n: 5}),
+				ContextStorer: StorerContext(discard{}),
+			}
+
+			n, err := CopyContext(context.Background(), &sys, 2, limits)
+			if err != io.EOF || n != 5 {
+				t.Fatalf("\t%s\tShould store 5 records : %d, %v", failed, n, err)
+			}
+			t.Logf("\t%s\tShould store 5 records.", succeed)
+
+			// The batches are 2, 2 and 1 records. The first one gets the token of the burst and each
+			// of the next two waits a second for the puller. The storer waits after each pull, by
+			// then its bucket was already refilled.
+			if got := clock.Waited(); got != 2*time.Second {
+				t.Fatalf("\t%s\tShould wait 2s, one second per batch after the first : %v", failed, got)
+			}
+			t.Logf("\t%s\tShould wait 2s, one second per batch after the first.", succeed)
+		}
+	}
+}
+
+// TestCancel validates that a cancelled wait returns right away and gives its token back.
+func TestCancel(t *testing.T) {
+	t.Log("Given the need to cancel a copy that is waiting for a token.")
+	{
+		clock := newFakeClock()
+		l := Limiter{Rate: 1, Burst: 1, Clock: clock}
+
+		t.Logf("\tTest 0:\tWhen the context is cancelled during a wait.")
+		{
+			if err := l.Wait(context.Background(), 1); err != nil {
+				t.Fatalf("\t%s\tShould take the token of the burst : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould take the token of the burst.", succeed)
+
+			clock.mu.Lock()
+			clock.block = true
+			clock.mu.Unlock()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-clock.waits
+				cancel()
+			}()
+
+			if err := l.Wait(ctx, 1); err != context.Canceled {
+				t.Fatalf("\t%s\tShould return context.Canceled : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return context.Canceled.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen a second has passed after the cancel.")
+		{
+			clock.mu.Lock()
+			clock.block = false
+			clock.mu.Unlock()
+			clock.Advance(time.Second)
+
+			if err := l.Wait(context.Background(), 1); err != nil {
+				t.Fatalf("\t%s\tShould take a token : %v", failed, err)
+			}
+			if got := clock.Waited(); got != 0 {
+				t.Fatalf("\t%s\tShould not wait, the cancelled token was given back : %v", failed, got)
+			}
+			t.Logf("\t%s\tShould not wait, the cancelled token was given back.", succeed)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// ---------------------------
+// Decoupling With Idempotency
+// ---------------------------
+
+// Data has carried a single Line string since the very first file. Real records need more than
+// that: a key that identifies the record, the time the event happened, some headers and a payload
+// of raw bytes. Because every function we wrote works with a *Data and never looks inside, changing
+// the fields of Data doesn't touch Copy, pull or store at all.
+
+// Once records have a key, we can make storing idempotent. A copy that is retried, resumed from an
+// older checkpoint or replayed from a dead letter sink sends records that were already stored.
+// Dedup is a Storer decorator that remembers the keys it stored and silently drops a record with a
+// key it has seen within the Window.
+
+// A few decisions worth calling out:
+// - A key is only remembered after the inner Store succeeds. A record that failed must be stored
+// when it comes back.
+// - Records without a key can't be told apart, so they are always stored.
+// - The window is based on when the record was stored, coming from a Clock so it can be tested.
+// Keys are kept in the order they were stored, so evicting the expired ones is just dropping them
+// off the front of a queue. Memory is bounded by how many records we store within one Window.
+
+//   Copy -store-> Dedup -- seen key within Window? --> drop
+//                   |
+//                   -- new key --> Pillar, remember key
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Key     string
+	Time    time.Time
+	Headers map[string]string
+	Payload []byte
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Clock declares behavior for telling the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock uses the real time.
+type realClock struct{}
+
+// Now returns the current time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Xenia is a system we need to pull data from.
+// It is flaky and sends some records more than once.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	n       int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1:
+		return io.EOF
+
+	case 2, 3:
+		// Send the previous record again.
+		if x.n > 0 {
+			break
+		}
+		fallthrough
+
+	default:
+		x.n++
+	}
+
+	*d = Data{
+		Key:     fmt.Sprintf("order-%d", x.n),
+		Time:    time.Now(),
+		Headers: map[string]string{"source": "xenia"},
+		Payload: []byte(fmt.Sprintf(`{"order":%d}`, x.n)),
+	}
+	fmt.Println("In:", d.Key)
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Printf("Out: %s %s %v %s\n", d.Key, d.Time.Format(time.RFC3339), d.Headers, d.Payload)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// seen is a key that was stored and when.
+type seen struct {
+	key string
+	at  time.Time
+}
+
+// Dedup is a Storer that drops records whose key was already stored within the Window.
+type Dedup struct {
+	Storer Storer
+	Window time.Duration
+	Clock  Clock // nil means the real time
+
+	Dropped int // number of records that were dropped as duplicates
+
+	keys  map[string]time.Time
+	queue []seen
+}
+
+// evict forgets every key that was stored before the window started.
+func (dd *Dedup) evict(now time.Time) {
+	start := now.Add(-dd.Window)
+
+	var i int
+	for ; i < len(dd.queue); i++ {
+		s := dd.queue[i]
+		if s.at.After(start) {
+			break
+		}
+
+		// The same key may be in the queue more than once if it was stored again after it
+		// expired. Only forget it if this is the entry the map points to.
+		if dd.keys[s.key].Equal(s.at) {
+			delete(dd.keys, s.key)
+		}
+	}
+
+	dd.queue = dd.queue[i:]
+}
+
+// Store knows how to store data into the inner Storer at most once per key within the window.
+func (dd *Dedup) Store(d *Data) error {
+	if d.Key == "" {
+		return dd.Storer.Store(d)
+	}
+
+	clock := dd.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	now := clock.Now()
+	if dd.keys == nil {
+		dd.keys = make(map[string]time.Time)
+	}
+	dd.evict(now)
+
+	if _, ok := dd.keys[d.Key]; ok {
+		dd.Dropped++
+		return nil
+	}
+
+	if err := dd.Storer.Store(d); err != nil {
+		return err
+	}
+
+	dd.keys[d.Key] = now
+	dd.queue = append(dd.queue, seen{key: d.Key, at: now})
+	return nil
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	dd := Dedup{
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+		Window: time.Minute,
+	}
+
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &dd,
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	fmt.Println("Dropped:", dd.Dropped)
+}
@@ -0,0 +1,381 @@
+// --------------------
+// Decoupling With HTTP
+// --------------------
+
+// Xenia and Pillar have been declaring Host and Timeout fields since decoupling_1.go and we have
+// never used them. Let's make them real systems that talk HTTP.
+
+// Xenia pages records with GET requests:
+//   GET http://{Host}/data?offset=0&limit=100
+//   {"data":[{"line":"..."}, ...],"next":100}
+// It keeps one page in memory and hands it out one record at a time from Pull. When a page comes
+// back empty, there is nothing left and Pull returns io.EOF.
+
+// Pillar stores records with POST requests. Sending a request per record would be slow, so we give
+// it one more behavior: StoreBatch, which sends the whole batch in a single request. store() asks
+// the Storer if it has that behavior and only falls back to one Store per record when it doesn't.
+// Like Resume in decoupling_9.go, System has to pass the behavior through explicitly, because only
+// the methods of the Storer interface are promoted from the embedded field. But StoreBatch makes
+// every System look like a BatchStorer, even one whose Storer can only store a record at a time.
+// So System returns ErrBatchUnsupported in that case, and store() falls back to one Store per
+// record, the same as when the behavior isn't there at all.
+
+// Both use an http.Client with Timeout set to the Timeout field. A request that takes longer than
+// that fails instead of hanging Copy forever.
+
+// Server is a reference implementation of the other side, an in memory store that speaks the same
+// protocol. With net/http/httptest we can start it on a local port, point Xenia and Pillar at it and
+// run Copy against a stand in, without any real system around.
+
+//                GET /data                       POST /data
+//   Server <--------------- Xenia -> Copy -> Pillar ---------------> Server
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string `json:"line"`
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// BatchStorer declares behavior for storing many records at once.
+type BatchStorer interface {
+	StoreBatch(data []Data) error
+}
+
+// ErrBatchUnsupported is returned by a StoreBatch that can't store a batch at once. Nothing was
+// stored and the records have to be stored one at a time instead.
+var ErrBatchUnsupported = errors.New("store batch not supported")
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// page is the body of a GET /data response.
+type page struct {
+	Data []Data `json:"data"`
+	Next int    `json:"next"`
+}
+
+// statusError checks the status code of a response and turns anything that is not 2xx into an
+// error that includes the body the server sent back.
+func statusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(b)))
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host     string
+	Timeout  time.Duration
+	PageSize int // zero means 100
+
+	client *http.Client
+	page   []Data
+	next   int
+	done   bool
+}
+
+// fetch gets the next page of records from Xenia.
+func (x *Xenia) fetch() error {
+	if x.client == nil {
+		x.client = &http.Client{Timeout: x.Timeout}
+	}
+
+	limit := x.PageSize
+	if limit <= 0 {
+		limit = 100
+	}
+
+	q := url.Values{}
+	q.Set("offset", strconv.Itoa(x.next))
+	q.Set("limit", strconv.Itoa(limit))
+
+	resp, err := x.client.Get("http://" + x.Host + "/data?" + q.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+
+	var p page
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return err
+	}
+
+	x.page = p.Data
+	x.next = p.Next
+	x.done = len(p.Data) == 0
+	return nil
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	if len(x.page) == 0 && !x.done {
+		if err := x.fetch(); err != nil {
+			return err
+		}
+	}
+
+	if len(x.page) == 0 {
+		return io.EOF
+	}
+
+	*d = x.page[0]
+	x.page = x.page[1:]
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+
+	client *http.Client
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	return p.StoreBatch([]Data{*d})
+}
+
+// StoreBatch knows how to store many records into Pillar with a single request.
+func (p *Pillar) StoreBatch(data []Data) error {
+	if p.client == nil {
+		p.client = &http.Client{Timeout: p.Timeout}
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Post("http://"+p.Host+"/data", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return statusError(resp)
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// StoreBatch knows how to store many records into the embedded Storer, when the Storer knows how
+// to store a batch. Otherwise it stores nothing and returns ErrBatchUnsupported.
+func (s *System) StoreBatch(data []Data) error {
+	bs, ok := s.Storer.(BatchStorer)
+	if !ok {
+		return ErrBatchUnsupported
+	}
+
+	return bs.StoreBatch(data)
+}
+
+// Server is an in memory store that speaks the same protocol as Xenia and Pillar.
+type Server struct {
+	mu   sync.Mutex
+	data []Data
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/data" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.get(w, r)
+
+	case http.MethodPost:
+		s.post(w, r)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// get returns a page of records.
+func (s *Server) get(w http.ResponseWriter, r *http.Request) {
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid offset", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		http.Error(w, "invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	end := offset + limit
+	if end > len(s.data) {
+		end = len(s.data)
+	}
+
+	p := page{
+		Data: []Data{},
+		Next: offset,
+	}
+	if offset < end {
+		p.Data = append(p.Data, s.data[offset:end]...)
+		p.Next = end
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&p)
+}
+
+// post appends a batch of records.
+func (s *Server) post(w http.ResponseWriter, r *http.Request) {
+	var data []Data
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.data = append(s.data, data...)
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Records returns a copy of every record in the server.
+func (s *Server) Records() []Data {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Data(nil), s.data...)
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+// When the Storer can store a whole batch at once, we let it. Either all of the batch is stored or
+// none of it is. Otherwise every record is stored on its own and we count how many made it.
+func store(s Storer, data []Data) (int, error) {
+	if bs, ok := s.(BatchStorer); ok {
+		err := bs.StoreBatch(data)
+		if err == nil {
+			return len(data), nil
+		}
+		if err != ErrBatchUnsupported {
+			return 0, err
+		}
+	}
+
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	// Start two local stand ins: one with data to pull and an empty one to store into.
+	var src Server
+	for i := 1; i <= 7; i++ {
+		src.data = append(src.data, Data{Line: fmt.Sprintf("Data %d", i)})
+	}
+	srcSrv := httptest.NewServer(&src)
+	defer srcSrv.Close()
+
+	var dst Server
+	dstSrv := httptest.NewServer(&dst)
+	defer dstSrv.Close()
+
+	sys := System{
+		Puller: &Xenia{
+			Host:     srcSrv.Listener.Addr().String(),
+			Timeout:  time.Second,
+			PageSize: 3,
+		},
+		Storer: &Pillar{
+			Host:    dstSrv.Listener.Addr().String(),
+			Timeout: time.Second,
+		},
+	}
+
+	if err := Copy(&sys, 2); err != io.EOF {
+		log.Fatal(err)
+	}
+
+	for _, d := range dst.Records() {
+		fmt.Println("Stored:", d.Line)
+	}
+}
@@ -0,0 +1,273 @@
+// --------------------------
+// Decoupling With Partitions
+// --------------------------
+
+// Pulling is cheap, storing is not. With a single Goroutine storing, every record waits for the
+// one in front of it even when they have nothing to do with each other. We want to store with N
+// workers in parallel.
+
+// We can't hand records to whichever worker is free. Two updates to the same order could be
+// stored out of order and the older one would win. What we can do is partition: hash the key of
+// the record and use it to pick the worker. Every record with the same key always goes to the same
+// worker, a channel is FIFO and a worker stores one record at a time, so records with the same key
+// are stored in the order they were pulled. Records with different keys are stored in parallel.
+
+// A few guarantees we have to keep:
+// - The Storer is now called from N Goroutines at once. It has to be safe for concurrent use.
+// - Failure: the first worker that fails cancels a context. The puller stops handing out records,
+// the other workers stop storing and Copy returns that first error once every worker is out.
+// - A slow partition only slows down the keys that hash to it, until its channel is full. Then the
+// puller blocks on it. This is the same back pressure we had with stages.
+
+//                       hash(key) % N
+//                    -----> [ ... ] -----> worker 0 --
+//   Xenia --> puller -----> [ ... ] -----> worker 1 ---> Pillar
+//                    -----> [ ... ] -----> worker 2 --
+//                                              |
+//                  ------- cancel() <----------
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Key  string
+	Line string
+	Seq  int // Position of the record within its key.
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+// A Storer used by Copy must be safe for concurrent use.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Xenia is a system we need to pull data from.
+// It sends updates for a handful of orders.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+	Records int
+
+	n    int
+	seqs map[string]int
+}
+
+// Pull knows how to pull data out of Xenia.
+func (x *Xenia) Pull(d *Data) error {
+	if x.n == x.Records {
+		return io.EOF
+	}
+	x.n++
+
+	if x.seqs == nil {
+		x.seqs = make(map[string]int)
+	}
+
+	key := fmt.Sprintf("order-%d", rand.Intn(5))
+	x.seqs[key]++
+
+	*d = Data{
+		Key:  key,
+		Line: fmt.Sprintf("update %d", x.seqs[key]),
+		Seq:  x.seqs[key],
+	}
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+// It checks that every key is stored in order and fails once it stored FailAfter records.
+type Pillar struct {
+	Host      string
+	Timeout   time.Duration
+	FailAfter int // zero means never
+
+	mu     sync.Mutex
+	stored int
+	last   map[string]int
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.FailAfter > 0 && p.stored == p.FailAfter {
+		return errors.New("Error storing data into Pillar")
+	}
+
+	if p.last == nil {
+		p.last = make(map[string]int)
+	}
+
+	if d.Seq != p.last[d.Key]+1 {
+		return fmt.Errorf("%s stored out of order: got %d after %d", d.Key, d.Seq, p.last[d.Key])
+	}
+
+	p.last[d.Key] = d.Seq
+	p.stored++
+	fmt.Println("Out:", d.Key, d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// partition returns the worker a key belongs to.
+func partition(key string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// Copy knows how to pull data from any System and store it with a number of workers in parallel.
+// Records with the same key are stored by the same worker, in the order they were pulled.
+// It returns the number of records that were stored and the error that ended the copy, which is
+// io.EOF when everything was copied.
+func Copy(ps PullStorer, batch int, workers int) (int, error) {
+	if batch < 1 {
+		batch = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only the first failure is kept. Whoever fails first also cancels the context, which is what
+	// stops everybody else.
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// Every worker owns a channel. Records are sent by value so the puller can reuse its batch.
+	var stored int64
+	var wg sync.WaitGroup
+	parts := make([]chan Data, workers)
+
+	for i := range parts {
+		parts[i] = make(chan Data, batch)
+
+		wg.Add(1)
+		go func(part <-chan Data) {
+			defer wg.Done()
+
+			for d := range part {
+				// Once somebody failed, the rest of the channel is dropped.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err := ps.Store(&d); err != nil {
+					fail(err)
+					continue
+				}
+				atomic.AddInt64(&stored, 1)
+			}
+		}(parts[i])
+	}
+
+	// The puller runs on this Goroutine. It owns the channels and closes them when it is done so
+	// the workers know there is nothing else coming.
+	data := make([]Data, batch)
+
+pull:
+	for {
+		i, err := pull(ps, data)
+
+		for _, d := range data[:i] {
+			select {
+			case parts[partition(d.Key, workers)] <- d:
+			case <-ctx.Done():
+				break pull
+			}
+		}
+
+		if err != nil {
+			// io.EOF is not a failure. The workers still have to finish what is in their channel.
+			if err != io.EOF {
+				fail(err)
+			}
+			break
+		}
+	}
+
+	for _, part := range parts {
+		close(part)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return int(stored), firstErr
+	}
+
+	return int(stored), io.EOF
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+func main() {
+	for _, failAfter := range []int{0, 12} {
+		sys := System{
+			Puller: &Xenia{
+				Host:    "localhost:8000",
+				Timeout: time.Second,
+				Records: 20,
+			},
+			Storer: &Pillar{
+				Host:      "localhost:9000",
+				Timeout:   time.Second,
+				FailAfter: failAfter,
+			},
+		}
+
+		n, err := Copy(&sys, 4, 3)
+		fmt.Printf("Stored %d: %v\n\n", n, err)
+	}
+}
@@ -0,0 +1,273 @@
+// ----------------------------
+// Decoupling With Cancellation
+// ----------------------------
+
+// Copy from the previous file loops until Pull returns an error. There is no way to stop it from
+// the outside. If we deploy in the middle of a copy job, the process is killed and we have no idea
+// how far we got.
+// The idiomatic way to tell a Goroutine to stop in Go is the context package. Instead of changing
+// Puller and Storer, which would break every concrete type that already implements them, we declare
+// two new interfaces, ContextPuller and ContextStorer, whose methods take a context.Context as the
+// first parameter.
+
+// We don't want to throw away Xenia, Pillar and the System embedding of Puller and Storer. They
+// still work. What we need is an adapter: a concrete type that stores any PullStorer and provides
+// the context aware behavior on top of it. Before every call, the adapter asks the context if it
+// has been cancelled. This gives us a cancellation point between every single record, which means
+// we can stop in the middle of a batch.
+
+// CopyContext now returns two values: how many records were already stored and the error. When
+// the context is cancelled, the caller gets ctx.Err() together with an accurate count so the job
+// can be resumed or at least reported on.
+
+//      CopyContext                       adapter                      System
+//   ----------------                 ---------------               -------------
+//  |  ContextPuller | -PullContext->|  ctx.Err()?   | -Pull------> |   Puller    |
+//  |  ContextStorer | -StoreContext>|  PullStorer   | -Store-----> |   Storer    |
+//   ----------------                 ---------------               -------------
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// ContextPuller declares behavior for pulling data that can be cancelled.
+type ContextPuller interface {
+	PullContext(ctx context.Context, d *Data) error
+}
+
+// ContextStorer declares behavior for storing data that can be cancelled.
+type ContextStorer interface {
+	StoreContext(ctx context.Context, d *Data) error
+}
+
+// ContextPullStorer declares behaviors for both pulling and storing with cancellation.
+type ContextPullStorer interface {
+	ContextPuller
+	ContextStorer
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1, 9:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+// We are pretending that storing takes some time so there is a window to cancel the copy.
+func (*Pillar) Store(d *Data) error {
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// adapter allows any PullStorer to be used as a ContextPullStorer.
+type adapter struct {
+	ps PullStorer
+}
+
+// WithContext returns a ContextPullStorer that checks for cancellation before every call into
+// the PullStorer. The PullStorer itself doesn't need to know anything about the context.
+func WithContext(ps PullStorer) ContextPullStorer {
+	return &adapter{ps: ps}
+}
+
+// PullContext knows how to pull data out of the PullStorer unless the context is done.
+func (a *adapter) PullContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.ps.Pull(d)
+}
+
+// StoreContext knows how to store data into the PullStorer unless the context is done.
+func (a *adapter) StoreContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.ps.Store(d)
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// pullContext knows how to pull bulks of data from any ContextPuller.
+func pullContext(ctx context.Context, p ContextPuller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.PullContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// storeContext knows how to store bulks of data from any ContextStorer.
+func storeContext(ctx context.Context, s ContextStorer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.StoreContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// CopyContext knows how to pull and store data from any System until the context is done.
+// It returns the number of records that were stored, even when the copy is cancelled half way
+// through a batch.
+func CopyContext(ctx context.Context, ps ContextPullStorer, batch int) (int, error) {
+	data := make([]Data, batch)
+	var stored int
+
+	for {
+		i, err := pullContext(ctx, ps, data)
+		if i > 0 {
+			n, err := storeContext(ctx, ps, data[:i])
+			stored += n
+			if err != nil {
+				return stored, err
+			}
+		}
+
+		if err != nil {
+			return stored, err
+		}
+	}
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	// The copy is cancelled when we receive an interrupt or a terminate signal, the same way a
+	// deploy would stop the process. Press Ctrl+C while it is running to see it.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	n, err := CopyContext(ctx, WithContext(&sys), 3)
+	switch err {
+	case io.EOF:
+		fmt.Println("Copy complete, stored:", n)
+	case context.Canceled:
+		fmt.Println("Copy cancelled, stored:", n)
+	default:
+		fmt.Println("Copy failed, stored:", n, "error:", err)
+	}
+}
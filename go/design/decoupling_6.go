@@ -0,0 +1,281 @@
+// ----------------------
+// Decoupling With Stages
+// ----------------------
+
+// CopyContext from the previous file is strictly sequential. It pulls a full batch, stores it,
+// then pulls again. While we are storing into Pillar, nobody is pulling from Xenia and while we are
+// pulling from Xenia, Pillar is sitting idle. A slow Pillar stalls Xenia entirely.
+
+// We can overlap the two with a pipeline. One Goroutine pulls batches and sends them into a
+// buffered channel. Another Goroutine receives batches from that channel and stores them. The
+// buffer is bounded, so when Pillar falls behind, the puller blocks on the send instead of pulling
+// the whole of Xenia into memory. This is back pressure.
+
+// A few guarantees we have to keep:
+// - Order: there is only one puller and one storer, and a channel is FIFO. Batches are stored in
+// the exact order they were pulled.
+// - Failure: when either side fails, both sides stop. We use a cancellable context for that. The
+// first failure cancels the context, the other side sees the cancellation and gets out.
+// - Reporting: we only return the first error. The cancellation that the other side sees after
+// that is a consequence, not a cause. Counts for both sides are returned so the caller knows how
+// many records were pulled and how many of those made it into the store.
+
+//                   batches (buffer: depth)
+//   puller  -----> [ []Data | []Data | ... ] -----> storer
+//     |                                               |
+//      ------------------ cancel() <------------------
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// ContextPuller declares behavior for pulling data that can be cancelled.
+type ContextPuller interface {
+	PullContext(ctx context.Context, d *Data) error
+}
+
+// ContextStorer declares behavior for storing data that can be cancelled.
+type ContextStorer interface {
+	StoreContext(ctx context.Context, d *Data) error
+}
+
+// ContextPullStorer declares behaviors for both pulling and storing with cancellation.
+type ContextPullStorer interface {
+	ContextPuller
+	ContextStorer
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	time.Sleep(50 * time.Millisecond)
+
+	switch rand.Intn(20) {
+	case 1:
+		return io.EOF
+
+	case 5:
+		return errors.New("Error reading data from Xenia")
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	time.Sleep(50 * time.Millisecond)
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// adapter allows any PullStorer to be used as a ContextPullStorer.
+type adapter struct {
+	ps PullStorer
+}
+
+// WithContext returns a ContextPullStorer that checks for cancellation before every call into
+// the PullStorer.
+func WithContext(ps PullStorer) ContextPullStorer {
+	return &adapter{ps: ps}
+}
+
+// PullContext knows how to pull data out of the PullStorer unless the context is done.
+func (a *adapter) PullContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.ps.Pull(d)
+}
+
+// StoreContext knows how to store data into the PullStorer unless the context is done.
+func (a *adapter) StoreContext(ctx context.Context, d *Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return a.ps.Store(d)
+}
+
+// pullContext knows how to pull bulks of data from any ContextPuller.
+func pullContext(ctx context.Context, p ContextPuller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.PullContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// storeContext knows how to store bulks of data from any ContextStorer.
+func storeContext(ctx context.Context, s ContextStorer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.StoreContext(ctx, &data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Result reports how far a copy got.
+type Result struct {
+	Pulled int
+	Stored int
+}
+
+// CopyPipeline knows how to pull and store data from any System with pulling and storing
+// overlapped. depth is the number of batches that can be waiting to be stored at any time.
+// io.EOF is returned once everything that was pulled has been stored.
+func CopyPipeline(ctx context.Context, ps ContextPullStorer, batch int, depth int) (Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Only the first failure is kept. Whoever fails first also cancels the context, which is what
+	// stops the other side.
+	var once sync.Once
+	var firstErr error
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	batches := make(chan []Data, depth)
+	done := make(chan struct{})
+
+	// The puller owns the pulled count and the batches channel. It closes the channel when it is
+	// done so the storer knows there is nothing else coming.
+	var pulled int
+	go func() {
+		defer close(done)
+		defer close(batches)
+
+		for {
+			// Every batch gets its own slice since the storer may still be working on the
+			// previous one.
+			data := make([]Data, batch)
+			i, err := pullContext(ctx, ps, data)
+			pulled += i
+
+			if i > 0 {
+				select {
+				case batches <- data[:i]:
+				case <-ctx.Done():
+					fail(ctx.Err())
+					return
+				}
+			}
+
+			if err != nil {
+				// io.EOF is not a failure. The storer still has to finish what is in the buffer.
+				if err != io.EOF {
+					fail(err)
+				}
+				return
+			}
+		}
+	}()
+
+	// The storer runs on this Goroutine. Once the context is cancelled, storeContext fails right
+	// away for everything that is left in the buffer.
+	var stored int
+	for data := range batches {
+		n, err := storeContext(ctx, ps, data)
+		stored += n
+		if err != nil {
+			fail(err)
+			break
+		}
+	}
+
+	// Wait for the puller to get out before we read its count.
+	<-done
+
+	res := Result{
+		Pulled: pulled,
+		Stored: stored,
+	}
+
+	if firstErr != nil {
+		return res, firstErr
+	}
+
+	return res, io.EOF
+}
+
+func main() {
+	sys := System{
+		Puller: &Xenia{
+			Host:    "localhost:8000",
+			Timeout: time.Second,
+		},
+		Storer: &Pillar{
+			Host:    "localhost:9000",
+			Timeout: time.Second,
+		},
+	}
+
+	start := time.Now()
+	res, err := CopyPipeline(context.Background(), WithContext(&sys), 3, 2)
+	if err != io.EOF {
+		fmt.Println(err)
+	}
+
+	fmt.Printf("Pulled: %d Stored: %d Took: %v\n", res.Pulled, res.Stored, time.Since(start))
+}
@@ -0,0 +1,339 @@
+// ----------------------------
+// Decoupling With Real Systems
+// ----------------------------
+
+// Xenia and Pillar are great for showing the mechanics but they generate random data and print
+// to stdout. Because Copy only works with the Puller and Storer interfaces, plugging in a real
+// source and a real sink doesn't require a single change to Copy. We just need new concrete types
+// that implement the behavior.
+
+// FilePuller reads Data records out of a file and FileStorer writes Data records into a file.
+// Neither of them knows anything about the format on disk. That is a decision that is left to a
+// Codec. A Codec knows how to create a Decoder for a reader and an Encoder for a writer, and that
+// is the only thing the file types need. This is the same decoupling we have been doing all
+// along, one level deeper: the file types are decoupled from the format the same way Copy is
+// decoupled from the files.
+
+// We provide two codecs:
+// - JSONLines: one JSON document per line, like {"line":"Data"}.
+// - CSV: one record per row, the first column is the line.
+// Anything else, say XML or protobuf, only needs another type that implements Codec.
+
+//                     Codec                            Codec
+//                  ----------                       ----------
+//                 | Decoder  |                     | Encoder  |
+//                  ----------                       ----------
+//                      |                                |
+//   file.jsonl -> FilePuller -pull-> Copy -store-> FileStorer -> file.csv
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string `json:"line"`
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Decoder declares behavior for reading a single record.
+// It must return io.EOF when there are no more records.
+type Decoder interface {
+	Decode(d *Data) error
+}
+
+// Encoder declares behavior for writing a single record.
+type Encoder interface {
+	Encode(d *Data) error
+}
+
+// Codec declares behavior for creating decoders and encoders for a format.
+type Codec interface {
+	NewDecoder(r io.Reader) Decoder
+	NewEncoder(w io.Writer) Encoder
+}
+
+// JSONLines is a codec for one JSON document per line.
+type JSONLines struct{}
+
+// NewDecoder returns a Decoder that reads JSON documents from r.
+func (JSONLines) NewDecoder(r io.Reader) Decoder {
+	return &jsonDecoder{dec: json.NewDecoder(r)}
+}
+
+// NewEncoder returns an Encoder that writes one JSON document per line into w.
+func (JSONLines) NewEncoder(w io.Writer) Encoder {
+	return &jsonEncoder{enc: json.NewEncoder(w)}
+}
+
+// jsonDecoder reads Data out of JSON documents.
+type jsonDecoder struct {
+	dec *json.Decoder
+}
+
+// Decode reads the next document into d.
+// Copy reuses the same Data values for every batch so we clear d first. Otherwise a field that is
+// missing from the document would keep the value from the previous record.
+func (dec *jsonDecoder) Decode(d *Data) error {
+	*d = Data{}
+	return dec.dec.Decode(d)
+}
+
+// jsonEncoder writes Data as JSON documents.
+type jsonEncoder struct {
+	enc *json.Encoder
+}
+
+// Encode writes d as a single document.
+// json.Encoder already adds the newline after each document.
+func (enc *jsonEncoder) Encode(d *Data) error {
+	return enc.enc.Encode(d)
+}
+
+// CSV is a codec for comma separated values where the first column is the line.
+type CSV struct{}
+
+// NewDecoder returns a Decoder that reads CSV rows from r.
+func (CSV) NewDecoder(r io.Reader) Decoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &csvDecoder{r: cr}
+}
+
+// NewEncoder returns an Encoder that writes CSV rows into w.
+func (CSV) NewEncoder(w io.Writer) Encoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+// csvDecoder reads Data out of CSV rows.
+type csvDecoder struct {
+	r *csv.Reader
+}
+
+// Decode reads the next row into d.
+func (dec *csvDecoder) Decode(d *Data) error {
+	record, err := dec.r.Read()
+	if err != nil {
+		return err
+	}
+
+	if len(record) == 0 {
+		return errors.New("csv: empty record")
+	}
+
+	d.Line = record[0]
+	return nil
+}
+
+// csvEncoder writes Data as CSV rows.
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+// Encode writes d as a single row.
+// csv.Writer keeps its own buffer so we flush it after every row. The file underneath is still
+// buffered so this doesn't cost us a system call per record.
+func (enc *csvEncoder) Encode(d *Data) error {
+	if err := enc.w.Write([]string{d.Line}); err != nil {
+		return err
+	}
+
+	enc.w.Flush()
+	return enc.w.Error()
+}
+
+// FilePuller is a system we can pull data from a file with.
+type FilePuller struct {
+	f   *os.File
+	dec Decoder
+}
+
+// OpenFile opens the file at path for pulling records in the format of the codec.
+func OpenFile(path string, codec Codec) (*FilePuller, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fp := FilePuller{
+		f:   f,
+		dec: codec.NewDecoder(bufio.NewReader(f)),
+	}
+
+	return &fp, nil
+}
+
+// Pull knows how to pull data out of a file.
+func (fp *FilePuller) Pull(d *Data) error {
+	return fp.dec.Decode(d)
+}
+
+// Close closes the underlying file.
+func (fp *FilePuller) Close() error {
+	return fp.f.Close()
+}
+
+// FileStorer is a system we can store data into a file with.
+type FileStorer struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc Encoder
+}
+
+// CreateFile creates or truncates the file at path for storing records in the format of the
+// codec.
+func CreateFile(path string, codec Codec) (*FileStorer, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(f)
+	fs := FileStorer{
+		f:   f,
+		w:   w,
+		enc: codec.NewEncoder(w),
+	}
+
+	return &fs, nil
+}
+
+// Store knows how to store data into a file.
+func (fs *FileStorer) Store(d *Data) error {
+	return fs.enc.Encode(d)
+}
+
+// Close flushes everything that is still buffered and closes the underlying file.
+// Without calling Close, the last records may never make it to disk.
+func (fs *FileStorer) Close() error {
+	if err := fs.w.Flush(); err != nil {
+		fs.f.Close()
+		return err
+	}
+
+	return fs.f.Close()
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	dir, err := ioutil.TempDir("", "decoupling")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Prepare a JSON Lines file to be our source.
+	src := filepath.Join(dir, "in.jsonl")
+	input := `{"line":"Data 1"}
+{"line":"Data, with a comma"}
+{"line":"Data 3"}
+{"line":"Data 4"}
+`
+	if err := ioutil.WriteFile(src, []byte(input), 0644); err != nil {
+		log.Fatal(err)
+	}
+
+	in, err := OpenFile(src, JSONLines{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer in.Close()
+
+	dst := filepath.Join(dir, "out.csv")
+	out, err := CreateFile(dst, CSV{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sys := System{
+		Puller: in,
+		Storer: out,
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		out.Close()
+		log.Fatal(err)
+	}
+
+	if err := out.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(dst)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Print(string(b))
+}
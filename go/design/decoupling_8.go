@@ -0,0 +1,324 @@
+// ------------------------
+// Decoupling With Retrying
+// ------------------------
+
+// Every now and then Xenia fails with "Error reading data from Xenia". Most of the time that is a
+// hiccup in the network and trying again a moment later works. Today that single failure kills the
+// whole Copy.
+
+// We don't want to put retry logic inside Copy, and we certainly don't want to put it inside every
+// Puller and Storer. What we do instead is decorate. RetryPuller is a Puller that stores another
+// Puller. When the inner Pull fails with an error that is worth retrying, it waits and tries again.
+// Copy has no idea that this is going on, it is still just calling Pull.
+
+// How do we know if an error is worth retrying? We don't want to type assert against the concrete
+// error types of every system we talk to. This is where behavior as context comes back from
+// error_4.go. We declare a temporary interface and ask the error if it has that behavior. Errors
+// that are temporary are retried, everything else, io.EOF included, is returned right away.
+
+// How long do we wait? If a system is struggling, hammering it with retries makes it worse. We back
+// off exponentially: 10ms, 20ms, 40ms... up to a maximum. Then we add jitter, a random amount taken
+// off the wait, so a lot of clients that failed at the same time don't all come back at the same
+// time.
+
+// The waiting goes through a Clock interface. In production it is the real time.Sleep. In a test
+// it can be a type that just records how long it was asked to sleep, so the test runs instantly.
+
+//         Copy ---pull---> RetryPuller ---pull---> Xenia
+//                               |
+//                      temporary? wait, again
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+)
+
+func init() {
+	rand.Seed(time.Now().UnixNano())
+}
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// temporary is declared to test for the existence of the method coming from any error.
+type temporary interface {
+	Temporary() bool
+}
+
+// xeniaError is returned when Xenia has a hiccup.
+type xeniaError struct {
+	msg string
+}
+
+// Error implements the error interface.
+func (e *xeniaError) Error() string {
+	return e.msg
+}
+
+// Temporary reports that trying again may work.
+func (e *xeniaError) Temporary() bool {
+	return true
+}
+
+// Xenia is a system we need to pull data from.
+type Xenia struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Pull knows how to pull data out of Xenia.
+func (*Xenia) Pull(d *Data) error {
+	switch rand.Intn(10) {
+	case 1, 9:
+		return io.EOF
+
+	case 4, 5:
+		return &xeniaError{"Error reading data from Xenia"}
+
+	default:
+		d.Line = "Data"
+		fmt.Println("In:", d.Line)
+		return nil
+	}
+}
+
+// Pillar is a system we need to store data into.
+type Pillar struct {
+	Host    string
+	Timeout time.Duration
+}
+
+// Store knows how to store data into Pillar.
+func (*Pillar) Store(d *Data) error {
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Clock declares behavior for waiting.
+type Clock interface {
+	Sleep(d time.Duration)
+}
+
+// realClock waits using the real time.
+type realClock struct{}
+
+// Sleep pauses the current Goroutine for at least the duration d.
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// Backoff describes how many times to try and how long to wait in between.
+type Backoff struct {
+	Attempts int           // Total number of calls, including the first one.
+	Base     time.Duration // Wait before the first retry.
+	Max      time.Duration // Upper bound for any single wait.
+	Clock    Clock         // nil means the real time.
+	Rand     *rand.Rand    // Source for the jitter. nil means the global source.
+}
+
+// wait returns how long to wait before the given retry, starting at 0.
+// The wait doubles on every retry and is capped at Max. The jitter takes up to half of it off.
+func (b *Backoff) wait(retry int) time.Duration {
+	d := b.Base
+	for i := 0; i < retry; i++ {
+		d *= 2
+		if b.Max > 0 && d >= b.Max {
+			d = b.Max
+			break
+		}
+	}
+
+	// A Base above Max is capped too, even for the first retry where the loop doesn't run.
+	if b.Max > 0 && d > b.Max {
+		d = b.Max
+	}
+
+	half := int64(d / 2)
+	if half == 0 {
+		return d
+	}
+
+	var jitter int64
+	if b.Rand != nil {
+		jitter = b.Rand.Int63n(half)
+	} else {
+		jitter = rand.Int63n(half)
+	}
+
+	return d - time.Duration(jitter)
+}
+
+// sleep waits for the given retry using the Clock.
+func (b *Backoff) sleep(retry int) {
+	clock := b.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+
+	clock.Sleep(b.wait(retry))
+}
+
+// do calls fn until it succeeds, returns an error that is not temporary or runs out of attempts.
+func (b *Backoff) do(fn func() error) error {
+	attempts := b.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			b.sleep(attempt - 1)
+		}
+
+		if err = fn(); err == nil || !isTemporary(err) {
+			return err
+		}
+	}
+
+	return fmt.Errorf("giving up after %d attempts: %w", attempts, err)
+}
+
+// isTemporary reports whether any error in the chain has the temporary behavior.
+func isTemporary(err error) bool {
+	var t temporary
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+
+	return false
+}
+
+// RetryPuller is a Puller that retries temporary failures of another Puller.
+type RetryPuller struct {
+	Puller  Puller
+	Backoff Backoff
+}
+
+// Pull knows how to pull data out of the inner Puller, trying again when it is temporary.
+func (r *RetryPuller) Pull(d *Data) error {
+	return r.Backoff.do(func() error {
+		return r.Puller.Pull(d)
+	})
+}
+
+// RetryStorer is a Storer that retries temporary failures of another Storer.
+type RetryStorer struct {
+	Storer  Storer
+	Backoff Backoff
+}
+
+// Store knows how to store data into the inner Storer, trying again when it is temporary.
+func (r *RetryStorer) Store(d *Data) error {
+	return r.Backoff.do(func() error {
+		return r.Storer.Store(d)
+	})
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// Copy knows how to pull and store data from any System.
+func Copy(ps PullStorer, batch int) error {
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			if _, err := store(ps, data[:i]); err != nil {
+				return err
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logClock is a Clock that tells us every time we are backing off.
+type logClock struct{}
+
+// Sleep logs and pauses the current Goroutine for at least the duration d.
+func (logClock) Sleep(d time.Duration) {
+	fmt.Println("Backoff:", d)
+	time.Sleep(d)
+}
+
+func main() {
+	backoff := Backoff{
+		Attempts: 5,
+		Base:     10 * time.Millisecond,
+		Max:      100 * time.Millisecond,
+		Clock:    logClock{},
+	}
+
+	sys := System{
+		Puller: &RetryPuller{
+			Puller: &Xenia{
+				Host:    "localhost:8000",
+				Timeout: time.Second,
+			},
+			Backoff: backoff,
+		},
+		Storer: &RetryStorer{
+			Storer: &Pillar{
+				Host:    "localhost:9000",
+				Timeout: time.Second,
+			},
+			Backoff: backoff,
+		},
+	}
+
+	if err := Copy(&sys, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+}
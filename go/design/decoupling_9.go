@@ -0,0 +1,327 @@
+// ---------------------------
+// Decoupling With Checkpoints
+// ---------------------------
+
+// When Copy dies half way through, we don't know which records made it into the store. Running it
+// again starts from the very beginning and stores everything a second time.
+
+// The fix is to remember how far we got. A Checkpointer stores a single number: the offset of the
+// next record that has not been stored yet. Copy commits the new offset right after every store, so
+// at any point in time the checkpoint is never ahead of what is really in the store.
+
+// When Copy starts, it loads the offset and has to get the Puller to that position. That is a new
+// behavior, so we declare a new interface: Resumer. A Puller that can jump to an offset, like a
+// file or a paginated API, implements it. For any other Puller, Copy falls back to pulling and
+// throwing away records until it reaches the offset. We ask for the behavior and don't care about
+// the concrete type, the same way we do with the temporary interface for errors.
+
+// We give Checkpointer two implementations:
+// - MemCheckpoint keeps the offset in memory. Good for tests and jobs that restart in process.
+// - FileCheckpoint keeps the offset in a file on disk. It writes to a temporary file, syncs it to
+// the disk and renames it, so a crash in the middle of a write never leaves a half written
+// checkpoint behind.
+
+//                    Load                     Commit
+//   Checkpointer -----------> Copy -------------------> Checkpointer
+//                              |
+//                    Resume(offset) or skip
+//                              |
+//                           Puller
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Data is the structure of the data we are copying.
+type Data struct {
+	Line string
+}
+
+// Puller declares behavior for pulling data.
+type Puller interface {
+	Pull(d *Data) error
+}
+
+// Storer declares behavior for storing data.
+type Storer interface {
+	Store(d *Data) error
+}
+
+// PullStorer declares behaviors for both pulling and storing.
+type PullStorer interface {
+	Puller
+	Storer
+}
+
+// Resumer declares behavior for moving a Puller to an offset.
+// After Resume(n), the next Pull returns the record at offset n, counting from 0.
+type Resumer interface {
+	Resume(offset int) error
+}
+
+// Checkpointer declares behavior for remembering how far a copy got.
+type Checkpointer interface {
+	Load() (int, error)
+	Commit(offset int) error
+}
+
+// MemCheckpoint is a Checkpointer that keeps the offset in memory.
+type MemCheckpoint struct {
+	mu     sync.Mutex
+	offset int
+}
+
+// Load returns the last committed offset.
+func (m *MemCheckpoint) Load() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.offset, nil
+}
+
+// Commit remembers the offset.
+func (m *MemCheckpoint) Commit(offset int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.offset = offset
+	return nil
+}
+
+// FileCheckpoint is a Checkpointer that keeps the offset in a file.
+type FileCheckpoint struct {
+	Path string
+}
+
+// Load returns the last committed offset. A file that doesn't exist yet means offset 0.
+func (f *FileCheckpoint) Load() (int, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// Commit writes the offset to the file.
+// The rename is what makes this safe. Either the old file or the new file is there, never a
+// file that is half written. The temporary file is synced before the rename, otherwise a power
+// loss could leave the new name pointing at data that never made it to the disk.
+func (f *FileCheckpoint) Commit(offset int) error {
+	tmp := f.Path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(strconv.Itoa(offset) + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.Path)
+}
+
+// Lines is a system we can pull data from a list of lines with.
+// It knows how to resume from any offset.
+type Lines struct {
+	lines []string
+	pos   int
+}
+
+// Pull knows how to pull data out of the list.
+func (l *Lines) Pull(d *Data) error {
+	if l.pos >= len(l.lines) {
+		return io.EOF
+	}
+
+	d.Line = l.lines[l.pos]
+	l.pos++
+	fmt.Println("In:", d.Line)
+	return nil
+}
+
+// Resume moves the next Pull to the given offset.
+func (l *Lines) Resume(offset int) error {
+	if offset < 0 || offset > len(l.lines) {
+		return fmt.Errorf("offset %d out of range [0, %d]", offset, len(l.lines))
+	}
+
+	l.pos = offset
+	return nil
+}
+
+// Pillar is a system we need to store data into.
+// To simulate a crash, it fails once it has stored FailAfter records. Zero means never.
+type Pillar struct {
+	FailAfter int
+	stored    int
+}
+
+// Store knows how to store data into Pillar.
+func (p *Pillar) Store(d *Data) error {
+	if p.FailAfter > 0 && p.stored == p.FailAfter {
+		return errors.New("Error writing data to Pillar")
+	}
+
+	p.stored++
+	fmt.Println("Out:", d.Line)
+	return nil
+}
+
+// System wraps Pullers and Stores together into a single system.
+type System struct {
+	Puller
+	Storer
+}
+
+// Resume moves the embedded Puller to the offset.
+// Only the methods of the Puller interface are promoted to System, not Resume, even when the
+// concrete Puller has it. Without this method, Copy would never see the Resumer behavior through
+// the System and would always skip records the slow way.
+func (s *System) Resume(offset int) error {
+	return resume(s.Puller, offset)
+}
+
+// pull knows how to pull bulks of data from any Puller.
+func pull(p Puller, data []Data) (int, error) {
+	for i := range data {
+		if err := p.Pull(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// store knows how to store bulks of data from any Storer.
+func store(s Storer, data []Data) (int, error) {
+	for i := range data {
+		if err := s.Store(&data[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(data), nil
+}
+
+// resume moves any Puller to the offset. If the Puller knows how to resume, we let it. If it
+// doesn't, we pull and throw away records until we get there.
+func resume(p Puller, offset int) error {
+	if r, ok := p.(Resumer); ok {
+		return r.Resume(offset)
+	}
+
+	var d Data
+	for i := 0; i < offset; i++ {
+		if err := p.Pull(&d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Copy knows how to pull and store data from any System, starting after the last checkpoint.
+// The checkpoint is committed after every store, including a store that only got part of the
+// batch through. Whatever was stored must never be stored again.
+func Copy(ps PullStorer, cp Checkpointer, batch int) error {
+	offset, err := cp.Load()
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		if err := resume(ps, offset); err != nil {
+			return err
+		}
+	}
+
+	data := make([]Data, batch)
+
+	for {
+		i, err := pull(ps, data)
+		if i > 0 {
+			n, serr := store(ps, data[:i])
+			if n > 0 {
+				offset += n
+				if err := cp.Commit(offset); err != nil {
+					return err
+				}
+			}
+
+			if serr != nil {
+				return serr
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func main() {
+	dir, err := ioutil.TempDir("", "decoupling")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cp := FileCheckpoint{
+		Path: filepath.Join(dir, "copy.checkpoint"),
+	}
+
+	lines := []string{"Data 0", "Data 1", "Data 2", "Data 3", "Data 4", "Data 5", "Data 6"}
+
+	// The first run dies after storing 4 records.
+	fmt.Println("First run")
+	sys := System{
+		Puller: &Lines{lines: lines},
+		Storer: &Pillar{FailAfter: 4},
+	}
+
+	if err := Copy(&sys, &cp, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	offset, _ := cp.Load()
+	fmt.Println("Checkpoint:", offset)
+
+	// The second run picks up right where the first one stopped.
+	fmt.Println("\nSecond run")
+	sys = System{
+		Puller: &Lines{lines: lines},
+		Storer: &Pillar{},
+	}
+
+	if err := Copy(&sys, &cp, 3); err != io.EOF {
+		fmt.Println(err)
+	}
+
+	offset, _ = cp.Load()
+	fmt.Println("Checkpoint:", offset)
+}
@@ -55,3 +55,9 @@ func webCall(b bool) error {
 
 	return ErrPageMoved
 }
+
+// A web service has one more step to take: the caller of webCall is a client on the other side of
+// the network, and it only sees a status code and a body. testing/web_server/handlers keeps a
+// registry that maps these same error variables to status codes and writes them as RFC 7807
+// problem details. It uses errors.Is instead of ==, so a handler can wrap ErrBadRequest with
+// more context and still get a 400.
@@ -12,19 +12,33 @@
 // can use those. This is type as context.
 // http://golang.org/src/pkg/encoding/json/decode.go
 
+// To see why those types carry the fields they do, Unmarshal below is a small but real decoder.
+// It walks the JSON text once and fills structs, maps, slices, arrays and scalars by reflection.
+// When a JSON value doesn't fit the Go value, there is no single string that would be enough
+// context. The caller wants to know what kind of JSON value it was, what Go type it was going into,
+// which field it was and where in the input it was. That is 4 pieces of information and a concrete
+// type is the only way to hand them back.
+
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
 )
 
 // An UnmarshalTypeError describes a JSON value that was not appropriate for
 // a value of a specific Go type.
 // Naming convention: The word "Error" ends at the name of the type.
 type UnmarshalTypeError struct {
-	Value string       // description of JSON value
-	Type  reflect.Type // type of Go value it could not be assigned to
+	Value  string       // description of JSON value - "bool", "array", "number -5"
+	Type   reflect.Type // type of Go value it could not be assigned to
+	Field  string       // path from the root to the value - "users[2].name"
+	Offset int64        // byte offset in the input where the value starts
 }
 
 // UnmarshalTypeError implements the error interface.
@@ -33,7 +47,12 @@ type UnmarshalTypeError struct {
 // not, we have a problem. Because why would you add a field to the custom error type and not
 // displaying on your log when this method would call. We only do this when we really need it.
 func (e *UnmarshalTypeError) Error() string {
-	return "json: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Field != "" {
+		return "json: cannot unmarshal " + e.Value + " into Go field " + e.Field + " of type " +
+			e.Type.String() + " at offset " + strconv.FormatInt(e.Offset, 10)
+	}
+	return "json: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String() +
+		" at offset " + strconv.FormatInt(e.Offset, 10)
 }
 
 // An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
@@ -55,44 +74,818 @@ func (e *InvalidUnmarshalError) Error() string {
 	return "json: Unmarshal(nil " + e.Type.String() + ")"
 }
 
+// A SyntaxError describes JSON text that is not valid.
+// There is nothing to say about types here. The message and where it happened is all we have.
+type SyntaxError struct {
+	msg    string // description of the problem
+	Offset int64  // byte offset in the input where the problem was found
+}
+
+// SyntaxError implements the error interface.
+func (e *SyntaxError) Error() string {
+	return "json: " + e.msg + " at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
 // user is a type for use in the Unmarshal call.
+// Name is an int on purpose, so a name like "bill" doesn't fit.
 type user struct {
-	Name int
+	Name    int
+	Email   string         `json:"email"`
+	Roles   []string       `json:"roles"`
+	Logins  map[string]int `json:"logins"`
+	Manager *user          `json:"manager"`
+}
+
+// admin embeds a user, the keys of the user fields fill the embedded user like they were admin's.
+type admin struct {
+	user
+	Level int `json:"level"`
 }
 
 func main() {
-	var u user
-	err := Unmarshal([]byte(`{"name":"bill"}`), u) // Run with a value and pointer.
-	if err != nil {
-		// This is a special type assertion that only works on the switch.
-		switch e := err.(type) {
-		case *UnmarshalTypeError:
-			fmt.Printf("UnmarshalTypeError: Value[%s] Type[%v]\n", e.Value, e.Type)
-		case *InvalidUnmarshalError:
-			fmt.Printf("InvalidUnmarshalError: Type[%v]\n", e.Type)
-		default:
-			fmt.Println(err)
+	inputs := []string{
+		`{"name":"bill"}`,
+		`{"name":1, "roles":["admin", 2]}`,
+		`{"name":1, "manager":{"logins":{"web":1.5}}}`,
+		`{"name":1, "email":"bill@ardanlabs.com",}`,
+		`{"name":1, "email":"bill@ardanlabs.com", "roles":["admin"], "logins":{"web":3}, "manager":{"name":2}}`,
+		`{"name":1, "manager":null}`,
+		`{"name":01}`,
+		`null`,
+	}
+
+	for _, input := range inputs {
+		var u user
+		err := Unmarshal([]byte(input), &u) // Run with a value and pointer.
+		if err != nil {
+			// This is a special type assertion that only works on the switch.
+			switch e := err.(type) {
+			case *UnmarshalTypeError:
+				fmt.Printf("UnmarshalTypeError: Value[%s] Type[%v] Field[%s] Offset[%d]\n", e.Value, e.Type, e.Field, e.Offset)
+			case *InvalidUnmarshalError:
+				fmt.Printf("InvalidUnmarshalError: Type[%v]\n", e.Type)
+			default:
+				fmt.Println(err)
+			}
+			continue
 		}
-		return
+
+		// null leaves a struct alone and sets a pointer to nil.
+		var manager interface{}
+		if u.Manager != nil {
+			manager = u.Manager.Name
+		}
+		fmt.Println("Name:", u.Name, "Email:", u.Email, "Roles:", u.Roles, "Logins:", u.Logins, "Manager:", manager)
+	}
+
+	// The fields of an embedded struct are promoted, the same way they are for Go code.
+	var a admin
+	if err := Unmarshal([]byte(`{"name":1, "email":"bill@ardanlabs.com", "level":2}`), &a); err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println("Name:", a.Name, "Email:", a.Email, "Level:", a.Level)
 	}
 
-	fmt.Println("Name:", u.Name)
+	// An empty interface takes any value, but a number still has to fit the float64 it becomes.
+	// Arrays can only be nested so deep.
+	for _, input := range []string{`null`, `[1, "two", null]`, `1e999`, strings.Repeat("[", 3000000)} {
+		var x interface{} = "unchanged"
+		if err := Unmarshal([]byte(input), &x); err != nil {
+			if e, ok := err.(*UnmarshalTypeError); ok {
+				fmt.Printf("UnmarshalTypeError: Value[%s] Type[%v] Offset[%d]\n", e.Value, e.Type, e.Offset)
+				continue
+			}
+			fmt.Println(err)
+			continue
+		}
+
+		fmt.Printf("Interface: %v\n", x)
+	}
 }
 
-// Unmarshal simulates an unmarshal call that always fails.
+// Unmarshal parses the JSON data and stores the result in the value pointed to by v.
 // Notice the parameters here: The first one is a slice of byte and the second one is an empty
 // interface. The empty interface basically says nothing, which means any value can be passed into
 // this function.
 // We are going to reflect on the concrete type that is stored inside this interface and we are
 // going to validate that if it is a pointer or not nil. We then return different error types
 // depending on these.
+// A value that doesn't fit its Go type is skipped and decoding goes on, the first
+// UnmarshalTypeError is returned at the end. A SyntaxError stops decoding right away.
 func Unmarshal(data []byte, v interface{}) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return &InvalidUnmarshalError{reflect.TypeOf(v)}
 	}
 
-	return &UnmarshalTypeError{"string", reflect.TypeOf(v)}
+	// Decoding starts at the value v points to. v itself is a copy of the caller's pointer and can't
+	// be set, which matters for a top level null.
+	d := decoder{data: data}
+	if err := d.value(rv.Elem()); err != nil {
+		return err
+	}
+
+	d.skipSpace()
+	if d.off < len(d.data) {
+		return d.syntaxError(fmt.Sprintf("invalid character %q after top-level value", d.data[d.off]))
+	}
+
+	return d.typeErr
+}
+
+// decoder walks the JSON text once, filling Go values as it goes.
+type decoder struct {
+	data    []byte
+	off     int      // next byte to read
+	path    []string // field names and indexes from the root to the current value
+	depth   int      // number of objects and arrays we are in
+	typeErr error    // first type error
+}
+
+// maxDepth is how deep objects and arrays can be nested, the same limit encoding/json has.
+// Every level is a call of the decoder, so without a limit a long enough run of [ runs out of
+// stack, and that is a fatal error, not a panic we can recover from.
+const maxDepth = 10000
+
+// enter goes one level deeper into an object or an array.
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return d.syntaxError("exceeded max depth")
+	}
+	return nil
+}
+
+// peek returns the next byte without reading it, 0 at the end of the input.
+func (d *decoder) peek() byte {
+	if d.off >= len(d.data) {
+		return 0
+	}
+	return d.data[d.off]
+}
+
+// skipSpace reads past any white space.
+func (d *decoder) skipSpace() {
+	for d.off < len(d.data) {
+		switch d.data[d.off] {
+		case ' ', '\t', '\n', '\r':
+			d.off++
+		default:
+			return
+		}
+	}
+}
+
+// syntaxError returns a SyntaxError at the current offset.
+func (d *decoder) syntaxError(msg string) error {
+	if d.off >= len(d.data) {
+		msg = "unexpected end of JSON input"
+	}
+	return &SyntaxError{msg: msg, Offset: int64(d.off)}
+}
+
+// typeError records a value starting at off that doesn't fit t. Only the first one is kept.
+func (d *decoder) typeError(value string, t reflect.Type, off int) {
+	if d.typeErr != nil {
+		return
+	}
+
+	d.typeErr = &UnmarshalTypeError{
+		Value:  value,
+		Type:   t,
+		Field:  strings.TrimPrefix(strings.Join(d.path, ""), "."),
+		Offset: int64(off),
+	}
+}
+
+// kind describes the JSON value starting with c.
+func kind(c byte) string {
+	switch c {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	}
+	return "number"
+}
+
+// indirect follows pointers down to the value they point to, allocating the nil ones.
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// value reads the next JSON value into v.
+func (d *decoder) value(v reflect.Value) error {
+	d.skipSpace()
+	start := d.off
+	c := d.peek()
+
+	// null only means something for types that can be nil. Everything else is left alone.
+	if c == 'n' {
+		if err := d.keyword("null"); err != nil {
+			return err
+		}
+
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	v = indirect(v)
+
+	// An empty interface takes whatever the JSON value is.
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() > 0 {
+			d.typeError(kind(c), v.Type(), start)
+			return d.skip()
+		}
+
+		x, err := d.any()
+		if err != nil {
+			return err
+		}
+
+		// null was handled above, so nil here is a value that didn't fit. The type error has
+		// been recorded and v is left alone.
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	switch c {
+	case '{':
+		return d.object(v)
+	case '[':
+		return d.array(v)
+	}
+	return d.literal(v)
+}
+
+// object reads a JSON object into a struct or a map with string keys.
+func (d *decoder) object(v reflect.Value) error {
+	start := d.off
+	t := v.Type()
+
+	switch {
+	case v.Kind() == reflect.Struct:
+		fields := structFields(t)
+		return d.members(func(key string) error {
+			index, ok := field(fields, key)
+			if !ok {
+				return d.skip()
+			}
+
+			d.path = append(d.path, "."+key)
+			err := d.value(fieldByIndex(v, index))
+			d.path = d.path[:len(d.path)-1]
+			return err
+		})
+
+	case v.Kind() == reflect.Map && t.Key().Kind() == reflect.String:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(t))
+		}
+
+		return d.members(func(key string) error {
+			elem := reflect.New(t.Elem()).Elem()
+
+			d.path = append(d.path, "."+key)
+			err := d.value(elem)
+			d.path = d.path[:len(d.path)-1]
+			if err != nil {
+				return err
+			}
+
+			v.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), elem)
+			return nil
+		})
+	}
+
+	d.typeError("object", t, start)
+	return d.skip()
+}
+
+// structField is a field a key can be decoded into. index leads to it through the embedded
+// structs it was promoted from, like the index of reflect.StructField.
+type structField struct {
+	name  string
+	index []int
+}
+
+// structFields lists the fields of t that keys can be decoded into, the way encoding/json does.
+// The json tag wins over the name of the field. Unexported fields and fields tagged "-" are
+// ignored. The fields of an embedded struct without a tag are promoted, unless a field with the
+// same name is less deep. Two fields with the same name at the same depth hide each other.
+func structFields(t reflect.Type) []structField {
+	type level struct {
+		t     reflect.Type
+		index []int
+	}
+
+	var fields []structField
+	seen := make(map[string]bool)
+	next := []level{{t: t}}
+
+	for len(next) > 0 {
+		current := next
+		next = nil
+
+		count := make(map[string]int)
+		var found []structField
+
+		for _, l := range current {
+			for i := 0; i < l.t.NumField(); i++ {
+				f := l.t.Field(i)
+				index := append(append([]int(nil), l.index...), i)
+
+				tag := f.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name := strings.Split(tag, ",")[0]
+
+				if f.Anonymous && name == "" {
+					ft := f.Type
+					if ft.Kind() == reflect.Ptr {
+						// An unexported embedded pointer can't be allocated through reflect.
+						if f.PkgPath != "" {
+							continue
+						}
+						ft = ft.Elem()
+					}
+					if ft.Kind() == reflect.Struct {
+						next = append(next, level{t: ft, index: index})
+						continue
+					}
+				}
+
+				if f.PkgPath != "" {
+					continue
+				}
+
+				if name == "" {
+					name = f.Name
+				}
+				count[name]++
+				found = append(found, structField{name: name, index: index})
+			}
+		}
+
+		for _, f := range found {
+			if seen[f.name] || count[f.name] > 1 {
+				continue
+			}
+			fields = append(fields, f)
+		}
+		for name := range count {
+			seen[name] = true
+		}
+	}
+
+	return fields
+}
+
+// field finds the field for a key. An exact match wins over a match that ignores case.
+func field(fields []structField, key string) ([]int, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f.index, true
+		}
+	}
+
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f.index, true
+		}
+	}
+
+	return nil, false
+}
+
+// fieldByIndex returns the field of v at index, allocating the embedded pointers on the way.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// array reads a JSON array into a slice or an array.
+func (d *decoder) array(v reflect.Value) error {
+	start := d.off
+	t := v.Type()
+
+	switch v.Kind() {
+	case reflect.Slice:
+		s := reflect.MakeSlice(t, 0, 0)
+		err := d.elements(func(i int) error {
+			elem := reflect.New(t.Elem()).Elem()
+
+			d.path = append(d.path, "["+strconv.Itoa(i)+"]")
+			err := d.value(elem)
+			d.path = d.path[:len(d.path)-1]
+
+			s = reflect.Append(s, elem)
+			return err
+		})
+		v.Set(s)
+		return err
+
+	case reflect.Array:
+		var n int
+		err := d.elements(func(i int) error {
+			n = i + 1
+			if i >= v.Len() {
+				return d.skip()
+			}
+
+			d.path = append(d.path, "["+strconv.Itoa(i)+"]")
+			err := d.value(v.Index(i))
+			d.path = d.path[:len(d.path)-1]
+			return err
+		})
+
+		// Whatever the JSON array didn't fill is set back to zero.
+		for i := n; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(t.Elem()))
+		}
+		return err
+	}
+
+	d.typeError("array", t, start)
+	return d.skip()
+}
+
+// literal reads a string, a number or a bool into v.
+func (d *decoder) literal(v reflect.Value) error {
+	start := d.off
+
+	switch c := d.peek(); {
+	case c == 't' || c == 'f':
+		b := c == 't'
+		kw := "false"
+		if b {
+			kw = "true"
+		}
+
+		if err := d.keyword(kw); err != nil {
+			return err
+		}
+
+		if v.Kind() != reflect.Bool {
+			d.typeError("bool", v.Type(), start)
+			return nil
+		}
+		v.SetBool(b)
+
+	case c == '"':
+		s, err := d.str()
+		if err != nil {
+			return err
+		}
+
+		if v.Kind() != reflect.String {
+			d.typeError("string", v.Type(), start)
+			return nil
+		}
+		v.SetString(s)
+
+	case c == '-' || ('0' <= c && c <= '9'):
+		lit, err := d.number()
+		if err != nil {
+			return err
+		}
+
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(lit, 10, 64)
+			if err != nil || v.OverflowInt(n) {
+				d.typeError("number "+lit, v.Type(), start)
+				return nil
+			}
+			v.SetInt(n)
+
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n, err := strconv.ParseUint(lit, 10, 64)
+			if err != nil || v.OverflowUint(n) {
+				d.typeError("number "+lit, v.Type(), start)
+				return nil
+			}
+			v.SetUint(n)
+
+		case reflect.Float32, reflect.Float64:
+			n, err := strconv.ParseFloat(lit, v.Type().Bits())
+			if err != nil || v.OverflowFloat(n) {
+				d.typeError("number "+lit, v.Type(), start)
+				return nil
+			}
+			v.SetFloat(n)
+
+		default:
+			d.typeError("number", v.Type(), start)
+		}
+
+	default:
+		return d.syntaxError(fmt.Sprintf("invalid character %q looking for beginning of value", c))
+	}
+
+	return nil
+}
+
+// members reads the members of an object, calling fn to read the value of each key.
+func (d *decoder) members(fn func(key string) error) error {
+	defer func() { d.depth-- }()
+	if err := d.enter(); err != nil {
+		return err
+	}
+
+	d.off++ // '{'
+	d.skipSpace()
+	if d.peek() == '}' {
+		d.off++
+		return nil
+	}
+
+	for {
+		d.skipSpace()
+		if d.peek() != '"' {
+			return d.syntaxError("looking for beginning of object key string")
+		}
+
+		key, err := d.str()
+		if err != nil {
+			return err
+		}
+
+		d.skipSpace()
+		if d.peek() != ':' {
+			return d.syntaxError("after object key")
+		}
+		d.off++
+
+		if err := fn(key); err != nil {
+			return err
+		}
+
+		d.skipSpace()
+		switch d.peek() {
+		case ',':
+			d.off++
+		case '}':
+			d.off++
+			return nil
+		default:
+			return d.syntaxError("after object key:value pair")
+		}
+	}
+}
+
+// elements reads the elements of an array, calling fn to read each one.
+func (d *decoder) elements(fn func(i int) error) error {
+	defer func() { d.depth-- }()
+	if err := d.enter(); err != nil {
+		return err
+	}
+
+	d.off++ // '['
+	d.skipSpace()
+	if d.peek() == ']' {
+		d.off++
+		return nil
+	}
+
+	for i := 0; ; i++ {
+		if err := fn(i); err != nil {
+			return err
+		}
+
+		d.skipSpace()
+		switch d.peek() {
+		case ',':
+			d.off++
+		case ']':
+			d.off++
+			return nil
+		default:
+			return d.syntaxError("after array element")
+		}
+	}
+}
+
+// any reads the next JSON value into the Go value an empty interface gets: map[string]interface{},
+// []interface{}, string, float64, bool or nil.
+func (d *decoder) any() (interface{}, error) {
+	d.skipSpace()
+
+	switch c := d.peek(); {
+	case c == '{':
+		m := make(map[string]interface{})
+		err := d.members(func(key string) error {
+			x, err := d.any()
+			m[key] = x
+			return err
+		})
+		return m, err
+
+	case c == '[':
+		a := make([]interface{}, 0)
+		err := d.elements(func(int) error {
+			x, err := d.any()
+			a = append(a, x)
+			return err
+		})
+		return a, err
+
+	case c == '"':
+		return d.str()
+
+	case c == 'n':
+		return nil, d.keyword("null")
+
+	case c == 't':
+		return true, d.keyword("true")
+
+	case c == 'f':
+		return false, d.keyword("false")
+
+	case c == '-' || ('0' <= c && c <= '9'):
+		start := d.off
+		lit, err := d.number()
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := strconv.ParseFloat(lit, 64)
+		if err != nil {
+			d.typeError("number "+lit, reflect.TypeOf(n), start)
+			return nil, nil
+		}
+		return n, nil
+	}
+
+	return nil, d.syntaxError(fmt.Sprintf("invalid character %q looking for beginning of value", d.peek()))
+}
+
+// skip reads past the next JSON value. It is used for values that have no place to go, so a
+// number that doesn't fit a float64 is not a type error here.
+func (d *decoder) skip() error {
+	typeErr := d.typeErr
+	_, err := d.any()
+	d.typeErr = typeErr
+	return err
+}
+
+// keyword reads one of true, false or null.
+func (d *decoder) keyword(kw string) error {
+	if !bytes.HasPrefix(d.data[d.off:], []byte(kw)) {
+		return d.syntaxError("invalid literal, expecting " + kw)
+	}
+
+	d.off += len(kw)
+	return nil
+}
+
+// number reads a number and returns it as it was written.
+func (d *decoder) number() (string, error) {
+	start := d.off
+	digits := func() bool {
+		from := d.off
+		for d.off < len(d.data) && '0' <= d.data[d.off] && d.data[d.off] <= '9' {
+			d.off++
+		}
+		return d.off > from
+	}
+
+	if d.peek() == '-' {
+		d.off++
+	}
+
+	// A number can't start with 0 and go on with more digits. We stop after the 0 and whatever
+	// comes next, like the 1 of 01, is an invalid character for the caller.
+	if d.peek() == '0' {
+		d.off++
+	} else if !digits() {
+		return "", d.syntaxError("in numeric literal")
+	}
+
+	if d.peek() == '.' {
+		d.off++
+		if !digits() {
+			return "", d.syntaxError("after decimal point in numeric literal")
+		}
+	}
+
+	if c := d.peek(); c == 'e' || c == 'E' {
+		d.off++
+		if c := d.peek(); c == '+' || c == '-' {
+			d.off++
+		}
+		if !digits() {
+			return "", d.syntaxError("in exponent of numeric literal")
+		}
+	}
+
+	return string(d.data[start:d.off]), nil
+}
+
+// str reads a quoted string, replacing the escape sequences.
+func (d *decoder) str() (string, error) {
+	d.off++ // '"'
+
+	var b strings.Builder
+	for {
+		if d.off >= len(d.data) {
+			return "", d.syntaxError("")
+		}
+
+		c := d.data[d.off]
+		switch {
+		case c == '"':
+			d.off++
+			return b.String(), nil
+
+		case c < 0x20:
+			return "", d.syntaxError(fmt.Sprintf("invalid character %q in string literal", c))
+
+		case c == '\\':
+			d.off++
+			if d.off >= len(d.data) {
+				return "", d.syntaxError("")
+			}
+
+			switch e := d.data[d.off]; e {
+			case '"', '\\', '/':
+				b.WriteByte(e)
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				r, ok := d.hex4(d.off + 1)
+				if !ok {
+					return "", d.syntaxError("in \\u hexadecimal character escape")
+				}
+				d.off += 4
+
+				// Characters outside the BMP come as a surrogate pair: \ud83d\ude00.
+				if utf16.IsSurrogate(r) {
+					if r2, ok := d.hex4(d.off + 3); ok && bytes.HasPrefix(d.data[d.off+1:], []byte(`\u`)) {
+						if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+							r = dec
+							d.off += 6
+						}
+					}
+				}
+				b.WriteRune(r)
+			default:
+				return "", d.syntaxError(fmt.Sprintf("invalid character %q in string escape code", e))
+			}
+			d.off++
+
+		default:
+			b.WriteByte(c)
+			d.off++
+		}
+	}
+}
+
+// hex4 decodes the 4 hexadecimal digits starting at off.
+func (d *decoder) hex4(off int) (rune, bool) {
+	if off+4 > len(d.data) {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(string(d.data[off:off+4]), 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return rune(n), true
 }
 
 // There is one flaw when using type as context here. In this case, we are now going back to the
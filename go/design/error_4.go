@@ -111,3 +111,15 @@ func (c *client) BehaviorAsContext() {
 // Thank to Go Implicit Conversion.
 // We can maintain a level of decopling by creating an interface with methods or behaviors that we only want,
 // and use it instead of concrete type for type assertion switch. 
+
+// The package in design/errors/behavior does this once for everybody. IsTemporary,
+// IsTimeout, IsRetryable and IsNotFound each declare the interface they need and walk the whole
+// chain of wrapped errors with errors.As, so a *net.OpError wrapped twice is still found:
+//   if !behavior.IsTemporary(err) {
+//       log.Println("Temporary: Client leaving chat")
+//       return
+//   }
+
+// design/chat is a whole chat server built around this read routine. It accepts connections,
+// asks for a name and sends every line to everybody else. A client leaves on io.EOF or on an
+// error that is not temporary.
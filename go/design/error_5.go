@@ -38,3 +38,9 @@ func main() {
 
 	log.Println("No Error")
 }
+
+// The compiler is happy with this code, so nothing but a careful review would catch it. The
+// analyzer in errptr can do it for us. It reports fail for returning *customError and the call in
+// main for storing it in err:
+//   error_5.go:18:22: fail returns concrete error type *customError instead of error
+//   error_5.go:35:14: fail returns concrete error type *customError, a nil *customError stored in error is not nil
@@ -15,13 +15,20 @@
 // to simplify our code. By reducing logging, we also reduce a large amount of pressure on the heap
 // (garbage collection).
 
+// Since Go 1.13, the standard library knows about wrapping too. An error that has an Unwrap method
+// is a chain and errors.Is and errors.As walk that chain for us. The errors package next to this
+// file is our own take on Dave's package built on that: Wrap and Wrapf still record the stack but
+// they also implement Unwrap, so we no longer need a third party package or a Cause function to
+// get back to the root of the error.
+
 package main
 
 import (
 	"fmt"
 
-	// This is Dave Cheney's errors package that have all the wrapping functions.
-	"github.com/pkg/errors"
+	// This is our errors package that have all the wrapping functions. It shadows the errors
+	// package of the standard library, but it provides Is, As and Unwrap as well.
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
 )
 
 // AppError represents a custom error type.
@@ -51,22 +58,31 @@ func main() {
 
 	// In main, we are handling the call, which means the error stops here and we have to log it.
 	// In order to properly handle this error, we need to know that the root cause of this error
-	// was. It is the original error that is not wrapped. Cause method will bubble up this error out of
-	// these wrapping and allow us to be able to use all the language mechanics we have.
+	// was. It is the original error that is not wrapped. errors.As walks down these wrapping until
+	// it finds an error of the type we ask for and allow us to be able to use all the language
+	// mechanics we have. There is no need to know how many times it was wrapped.
 
 	// We are not only be able to access the State even though we've done this assertion back to
 	// concrete, we can log out the entire stack trace by using %+v for this call.
 
 	if err := firstCall(10); err != nil {
 		// Use type as context to determine cause.
+		var app *AppError
+		if errors.As(err, &app) {
+			// We got our custom error type.
+			fmt.Println("Custom App Error:", app.State)
+		} else {
+			// We did not get any specific error type.
+			fmt.Println("Default Error")
+		}
+
+		// Code that was written for github.com/pkg/errors keeps working with Cause.
 		switch v := errors.Cause(err).(type) {
 		case *AppError:
-			// We got our custom error type.
-			fmt.Println("Custom App Error:", v.State)
+			fmt.Println("Cause:", v.State)
 
 		default:
-			// We did not get any specific error type.
-			fmt.Println("Default Error")
+			fmt.Println("Cause: Default Error")
 		}
 
 		// Display the stack trace for the error.
@@ -74,6 +90,17 @@ func main() {
 		fmt.Printf("%+v\n", err)
 		fmt.Println("\nNo Trace\n********************************")
 		fmt.Printf("%v\n", err)
+
+		// A log pipeline wants fields, not text it has to parse. JSON writes every layer of the
+		// chain with its operation, its type and the function, file and line of each frame.
+		// DefaultTrim drops the runtime frames and the GOROOT and GOPATH prefixes of the files.
+		fmt.Println("\nJSON\n********************************")
+		data, jerr := errors.JSON(err, errors.DefaultTrim())
+		if jerr != nil {
+			fmt.Println(jerr)
+			return
+		}
+		fmt.Println(string(data))
 	}
 }
 
@@ -93,7 +120,8 @@ func secondCall(i int) error {
 	return nil
 }
 
-// thirdCall function creates an error value we will validate.
+// thirdCall function creates an error value we will validate. WithOp names the operation that
+// failed, so the logs can be searched by it, and records the stack where it happened.
 func thirdCall() error {
-	return &AppError{99}
+	return errors.WithOp(&AppError{99}, "thirdCall")
 }
@@ -0,0 +1,88 @@
+// Package behavior classifies errors by what they can do instead of what they are.
+//
+// error_4.go replaced a type switch on *net.OpError, *net.AddrError and *net.DNSConfigError with a
+// temporary interface of our own. These functions take that idea all the way: every consumer asks
+// the same questions the same way, and each question walks the whole chain of wrapped errors
+// with errors.As and errors.Is.
+//
+// When more than one error in the chain has an opinion, the outermost one wins. That is the one
+// that was added last and knows the most about the failure.
+package behavior
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+)
+
+// temporary is the behavior of errors that may go away on their own.
+// The net, os and syscall packages, and context.DeadlineExceeded all have it.
+type temporary interface {
+	Temporary() bool
+}
+
+// timeout is the behavior of errors that happened because something took too long.
+type timeout interface {
+	Timeout() bool
+}
+
+// retryable is the behavior of errors that know better than us whether trying again makes sense.
+// Our own types can implement it to overrule the other checks.
+type retryable interface {
+	Retryable() bool
+}
+
+// notFound is the behavior of errors that say something doesn't exist.
+type notFound interface {
+	NotFound() bool
+}
+
+// IsTemporary reports whether err says it is temporary.
+func IsTemporary(err error) bool {
+	var t temporary
+	return errors.As(err, &t) && t.Temporary()
+}
+
+// IsTimeout reports whether err says it is a timeout.
+// This covers net timeouts, like a read past its deadline, and context.DeadlineExceeded.
+func IsTimeout(err error) bool {
+	var t timeout
+	return errors.As(err, &t) && t.Timeout()
+}
+
+// IsRetryable reports whether it makes sense to try the failed operation again:
+//   - false if the context was cancelled. Whoever cancelled it doesn't want the result anymore.
+//   - the answer of the first error in the chain with a Retryable method, if there is one.
+//   - otherwise, true if err is temporary or a timeout.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var r retryable
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+
+	return IsTemporary(err) || IsTimeout(err)
+}
+
+// IsNotFound reports whether err says that what was asked for doesn't exist:
+//   - the answer of the first error in the chain with a NotFound method, if there is one.
+//   - a *net.DNSError for a host that doesn't exist.
+//   - os.ErrNotExist, which matches the errors of os.Open and friends, and sql.ErrNoRows.
+func IsNotFound(err error) bool {
+	var nf notFound
+	if errors.As(err, &nf) {
+		return nf.NotFound()
+	}
+
+	var dns *net.DNSError
+	if errors.As(err, &dns) {
+		return dns.IsNotFound
+	}
+
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,116 @@
+// -------------
+// Behavior test
+// -------------
+
+// Run test using "go test -v ./go/design/errors/behavior"
+
+// We are using behavior_test for package name because we want to make sure we only touch the
+// exported API.
+package behavior_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+	"github.com/hoanhan101/ultimate-go/go/design/errors/behavior"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// busyError is one of our own types. It overrules the other checks with Retryable.
+type busyError struct {
+	retry bool
+}
+
+func (e *busyError) Error() string   { return "busy" }
+func (e *busyError) Temporary() bool { return true }
+func (e *busyError) Retryable() bool { return e.retry }
+
+// missingError is one of our own types that says something doesn't exist.
+type missingError struct{}
+
+func (missingError) Error() string  { return "missing" }
+func (missingError) NotFound() bool { return true }
+
+// TestClassify validates the answers of every check for errors of all kinds, wrapped or not.
+func TestClassify(t *testing.T) {
+	busy := &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	// The errors of an expired deadline and a closed listener are made for real, the sentinels for
+	// them only exist since Go 1.15 and 1.16.
+	conn, _ := net.Pipe()
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now())
+	_, deadline := conn.Read(make([]byte, 1))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	_, closed := l.Accept()
+
+	dns := &net.DNSError{Err: "no such host", Name: "xenia.invalid", IsNotFound: true}
+	_, open := os.Open("/does/not/exist")
+
+	tests := []struct {
+		name      string
+		err       error
+		temporary bool
+		timeout   bool
+		retryable bool
+		notFound  bool
+	}{
+		{"nil", nil, false, false, false, false},
+		{"io.EOF", io.EOF, false, false, false, false},
+		{"too many open files", busy, true, false, true, false},
+		{"read deadline", deadline, true, true, true, false},
+		{"closed listener", closed, false, false, false, false},
+		{"unknown host", dns, false, false, false, true},
+		{"context deadline", context.DeadlineExceeded, true, true, true, false},
+		{"context canceled", context.Canceled, false, false, false, false},
+		{"os.Open", open, false, false, false, true},
+		{"sql.ErrNoRows", sql.ErrNoRows, false, false, false, true},
+		{"busy and retryable", &busyError{retry: true}, true, false, true, false},
+		{"busy and not retryable", &busyError{retry: false}, true, false, false, false},
+		{"missing", missingError{}, false, false, false, true},
+		{"wrapped by fmt", fmt.Errorf("pull: %w", deadline), true, true, true, false},
+		{"wrapped by errors", errors.Wrap(errors.Wrap(busy, "accept"), "serve"), true, false, true, false},
+		{"wrapped cancel", fmt.Errorf("copy: %w", fmt.Errorf("pull: %w", context.Canceled)), false, false, false, false},
+		{"collected", errors.MultiError{io.EOF, missingError{}}, false, false, false, true},
+	}
+
+	t.Log("Given the need to classify errors by their behavior.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen checking %s.", i, tt.name)
+			{
+				got := []bool{
+					behavior.IsTemporary(tt.err),
+					behavior.IsTimeout(tt.err),
+					behavior.IsRetryable(tt.err),
+					behavior.IsNotFound(tt.err),
+				}
+				want := []bool{tt.temporary, tt.timeout, tt.retryable, tt.notFound}
+
+				for j, check := range []string{"IsTemporary", "IsTimeout", "IsRetryable", "IsNotFound"} {
+					if got[j] != want[j] {
+						t.Errorf("\t%s\tShould get %v from %s. Received[%v].", failed, want[j], check, got[j])
+						continue
+					}
+					t.Logf("\t%s\tShould get %v from %s.", succeed, want[j], check)
+				}
+			}
+		}
+	}
+}
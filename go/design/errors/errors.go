@@ -0,0 +1,265 @@
+// Package errors provides error values that record the stack where they were created or wrapped.
+// It replaces github.com/pkg/errors in error_6.go. Everything it returns works with the Go 1.13
+// Is, As and Unwrap functions, which are also available here so a single import is enough.
+//
+// Wrap adds context to an error and the stack of the caller:
+//   if err := thirdCall(); err != nil {
+//       return errors.Wrap(err, "secondCall->thirdCall()")
+//   }
+//
+// The error that was wrapped can be found by type or by value:
+//   var app *AppError
+//   if errors.As(err, &app) {
+//       fmt.Println(app.State)
+//   }
+//
+// Printing with %+v shows every message along with the stack it was added at. JSON writes the same
+// chain with the operation names and the frames as fields, for a log pipeline.
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// New returns an error with the message and the stack of the caller.
+func New(message string) error {
+	return &fundamental{
+		msg:   message,
+		stack: callers(),
+	}
+}
+
+// Errorf formats the message like fmt.Errorf and records the stack of the caller.
+// The %w verb is supported, the error it formats can be reached with Unwrap, Is and As. With more
+// than one %w, the errors can be reached with Is and As.
+func Errorf(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+	switch err.(type) {
+	case interface{ Unwrap() error }, interface{ Unwrap() []error }:
+	default:
+		return &fundamental{
+			msg:   err.Error(),
+			stack: callers(),
+		}
+	}
+
+	return &withStack{
+		error: err,
+		stack: callers(),
+	}
+}
+
+// WithStack records the stack of the caller on err. It returns nil if err is nil.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &withStack{
+		error: err,
+		stack: callers(),
+	}
+}
+
+// Wrap returns an error that adds the message and the stack of the caller to err.
+// It returns nil if err is nil.
+func Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &wrapped{
+		msg:   message,
+		cause: err,
+		stack: callers(),
+	}
+}
+
+// Wrapf returns an error that adds the formatted message and the stack of the caller to err.
+// It returns nil if err is nil.
+func Wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	return &wrapped{
+		msg:   fmt.Sprintf(format, args...),
+		cause: err,
+		stack: callers(),
+	}
+}
+
+// WithOp returns an error that adds the name of the operation that failed and the stack of the
+// caller to err. It returns nil if err is nil.
+//   return errors.WithOp(err, "user.Save")
+func WithOp(err error, op string) error {
+	if err == nil {
+		return nil
+	}
+
+	return &wrapped{
+		msg:   op,
+		op:    op,
+		cause: err,
+		stack: callers(),
+	}
+}
+
+// Op returns the name of the outermost operation in the chain of err, or "" if there is none.
+func Op(err error) string {
+	var w *wrapped
+	for As(err, &w) {
+		if w.op != "" {
+			return w.op
+		}
+		err = w.cause
+	}
+
+	return ""
+}
+
+// Cause returns the error at the bottom of the chain, the one that was not wrapped.
+// It follows both the Cause method of github.com/pkg/errors and the Go 1.13 Unwrap method, so it
+// works for callers that have not moved to Is and As yet.
+func Cause(err error) error {
+	for err != nil {
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			next := e.Unwrap()
+			if next == nil {
+				return err
+			}
+			err = next
+		default:
+			return err
+		}
+	}
+
+	return err
+}
+
+// Is reports whether any error in the chain of err matches target.
+// It is errors.Is from the standard library.
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As finds the first error in the chain of err that matches target, and if so, sets target to that
+// error value and returns true. It is errors.As from the standard library.
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
+
+// Unwrap returns the result of calling the Unwrap method on err, if any.
+// It is errors.Unwrap from the standard library.
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
+
+// fundamental is an error that has a message and a stack but no cause.
+type fundamental struct {
+	msg string
+	*stack
+}
+
+// Error implements the error interface.
+func (f *fundamental) Error() string {
+	return f.msg
+}
+
+// Format implements the fmt.Formatter interface.
+// %s and %v print the message, %q prints it quoted and %+v adds the stack.
+func (f *fundamental) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			io.WriteString(s, f.msg)
+			f.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, f.msg)
+	case 'q':
+		fmt.Fprintf(s, "%q", f.msg)
+	}
+}
+
+// withStack is an error with a stack but no message of its own.
+type withStack struct {
+	error
+	*stack
+}
+
+// Cause returns the error that was given a stack.
+func (w *withStack) Cause() error {
+	return w.error
+}
+
+// Unwrap returns the error that was given a stack.
+func (w *withStack) Unwrap() error {
+	return w.error
+}
+
+// Format implements the fmt.Formatter interface.
+func (w *withStack) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v", w.error)
+			w.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, w.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", w.Error())
+	}
+}
+
+// wrapped is an error that adds a message and a stack to another error.
+type wrapped struct {
+	msg   string
+	op    string // name of the operation, for errors created by WithOp
+	cause error
+	*stack
+}
+
+// Error implements the error interface.
+func (w *wrapped) Error() string {
+	return w.msg + ": " + w.cause.Error()
+}
+
+// Cause returns the error that was wrapped.
+func (w *wrapped) Cause() error {
+	return w.cause
+}
+
+// Unwrap returns the error that was wrapped.
+func (w *wrapped) Unwrap() error {
+	return w.cause
+}
+
+// Format implements the fmt.Formatter interface.
+// %+v prints the cause first, then every message that was added on top of it with its stack.
+func (w *wrapped) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v\n", w.cause)
+			io.WriteString(s, w.msg)
+			w.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, w.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", w.Error())
+	}
+}
@@ -0,0 +1,277 @@
+// -----------
+// Errors test
+// -----------
+
+// Run test using "go test -v ./go/design/errors"
+
+// We are using errors_test for package name because we want to make sure we only touch the
+// exported API.
+package errors_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errors"
+)
+
+const (
+	succeed = "\u2713"
+	failed  = "\u2717"
+)
+
+// AppError represents a custom error type.
+type AppError struct {
+	State int
+}
+
+// AppError implements the error interface.
+func (c *AppError) Error() string {
+	return fmt.Sprintf("App Error, State: %d", c.State)
+}
+
+// TestWrap validates that a wrapped error can still be found by value and by type.
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Wrap", errors.Wrap(&AppError{99}, "read")},
+		{"Wrapf", errors.Wrapf(errors.Wrap(&AppError{99}, "read"), "call(%d)", 10)},
+		{"WithStack", errors.WithStack(&AppError{99})},
+		{"Errorf", errors.Errorf("call(%d): %w", 10, &AppError{99})},
+	}
+
+	t.Log("Given the need to find an error through the wrapping.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen using %s.", i, tt.name)
+			{
+				var app *AppError
+				if !errors.As(tt.err, &app) || app.State != 99 {
+					t.Fatalf("\t%s\tShould find the *AppError with As : %v", failed, tt.err)
+				}
+				t.Logf("\t%s\tShould find the *AppError with As.", succeed)
+
+				if !errors.Is(tt.err, app) {
+					t.Fatalf("\t%s\tShould match the *AppError with Is.", failed)
+				}
+				t.Logf("\t%s\tShould match the *AppError with Is.", succeed)
+
+				if errors.Cause(tt.err) != app {
+					t.Fatalf("\t%s\tShould return the *AppError from Cause : %v", failed, errors.Cause(tt.err))
+				}
+				t.Logf("\t%s\tShould return the *AppError from Cause.", succeed)
+			}
+		}
+	}
+}
+
+// TestErrorfMulti validates that every error of an Errorf with more than one %w can be found.
+func TestErrorfMulti(t *testing.T) {
+	t.Log("Given the need to find the errors of an Errorf with two %w.")
+	{
+		t.Logf("\tTest 0:\tWhen wrapping an *AppError and io.EOF.")
+		{
+			err := errors.Errorf("call(%d): %w: %w", 10, &AppError{99}, io.EOF)
+
+			var app *AppError
+			if !errors.As(err, &app) || app.State != 99 {
+				t.Fatalf("\t%s\tShould find the *AppError with As : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould find the *AppError with As.", succeed)
+
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("\t%s\tShould match io.EOF with Is : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould match io.EOF with Is.", succeed)
+
+			if !strings.Contains(fmt.Sprintf("%+v", err), "TestErrorfMulti") {
+				t.Fatalf("\t%s\tShould record the stack : %+v", failed, err)
+			}
+			t.Logf("\t%s\tShould record the stack.", succeed)
+		}
+	}
+}
+
+// TestNil validates that wrapping nil is nil.
+func TestNil(t *testing.T) {
+	t.Log("Given the need to wrap the result of a call that may not fail.")
+	{
+		t.Logf("\tTest 0:\tWhen the error is nil.")
+		{
+			if errors.Wrap(nil, "read") != nil || errors.Wrapf(nil, "read %d", 1) != nil || errors.WithStack(nil) != nil {
+				t.Fatalf("\t%s\tShould return nil.", failed)
+			}
+			t.Logf("\t%s\tShould return nil.", succeed)
+		}
+	}
+}
+
+// TestFormat validates the messages with and without the stack.
+func TestFormat(t *testing.T) {
+	err := errors.Wrap(errors.Wrap(io.EOF, "pull"), "copy")
+
+	t.Log("Given the need to print an error.")
+	{
+		t.Logf("\tTest 0:\tWhen printing with %%v.")
+		{
+			if got := fmt.Sprintf("%v", err); got != "copy: pull: EOF" {
+				t.Fatalf("\t%s\tShould print every message on one line : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould print every message on one line.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen printing with %%+v.")
+		{
+			got := fmt.Sprintf("%+v", err)
+			if !strings.HasPrefix(got, "EOF\npull\n") {
+				t.Fatalf("\t%s\tShould print the cause first : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould print the cause first.", succeed)
+
+			if !strings.Contains(got, "errors_test.TestFormat\n\t") || !strings.Contains(got, "errors_test.go:") {
+				t.Fatalf("\t%s\tShould print the stack : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould print the stack.", succeed)
+		}
+	}
+}
+
+// TestJSON validates the operation names and frames that are written for a log pipeline.
+func TestJSON(t *testing.T) {
+	err := errors.Wrap(errors.WithOp(&AppError{99}, "user.Save"), "copy")
+
+	t.Log("Given the need to send an error to a log pipeline.")
+	{
+		t.Logf("\tTest 0:\tWhen an operation was named.")
+		{
+			if got := errors.Op(err); got != "user.Save" {
+				t.Fatalf("\t%s\tShould find the operation : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould find the operation.", succeed)
+
+			if got := err.Error(); got != "copy: user.Save: App Error, State: 99" {
+				t.Fatalf("\t%s\tShould add the operation to the message : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould add the operation to the message.", succeed)
+
+			if got := errors.Op(errors.Wrap(io.EOF, "copy")); got != "" {
+				t.Fatalf("\t%s\tShould not find an operation when there is none : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould not find an operation when there is none.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen resolving the frames.")
+		{
+			layers := errors.Layers(err, errors.DefaultTrim())
+			if len(layers) != 3 {
+				t.Fatalf("\t%s\tShould have a layer for each error : %+v", failed, layers)
+			}
+			t.Logf("\t%s\tShould have a layer for each error.", succeed)
+
+			frames := layers[1].Frames
+			if len(frames) == 0 || frames[0].Function != "github.com/hoanhan101/ultimate-go/go/design/errors_test.TestJSON" {
+				t.Fatalf("\t%s\tShould start at the caller of WithOp : %+v", failed, frames)
+			}
+			t.Logf("\t%s\tShould start at the caller of WithOp.", succeed)
+
+			for _, f := range frames {
+				if strings.HasPrefix(f.Function, "runtime.") {
+					t.Fatalf("\t%s\tShould drop the runtime frames : %+v", failed, f)
+				}
+			}
+			t.Logf("\t%s\tShould drop the runtime frames.", succeed)
+
+			trim := errors.Trim{Prefixes: []string{strings.TrimSuffix(frames[0].File, "errors_test.go")}}
+			if got := errors.Layers(err, trim)[1].Frames[0].File; got != "errors_test.go" {
+				t.Fatalf("\t%s\tShould remove the prefix of the file : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould remove the prefix of the file.", succeed)
+		}
+
+		t.Logf("\tTest 2:\tWhen writing JSON.")
+		{
+			data, jerr := errors.JSON(err, errors.DefaultTrim())
+			if jerr != nil {
+				t.Fatalf("\t%s\tShould write JSON : %v", failed, jerr)
+			}
+			t.Logf("\t%s\tShould write JSON.", succeed)
+
+			var doc struct {
+				Error  string
+				Op     string
+				Layers []errors.Layer
+			}
+			if jerr := json.Unmarshal(data, &doc); jerr != nil {
+				t.Fatalf("\t%s\tShould read the JSON back : %v", failed, jerr)
+			}
+			t.Logf("\t%s\tShould read the JSON back.", succeed)
+
+			if doc.Error != err.Error() || doc.Op != "user.Save" || doc.Layers[2].Type != "*errors_test.AppError" {
+				t.Fatalf("\t%s\tShould keep the message, operation and type : %s", failed, data)
+			}
+			t.Logf("\t%s\tShould keep the message, operation and type.", succeed)
+		}
+	}
+}
+
+// TestCollector validates errors collected from many Goroutines.
+func TestCollector(t *testing.T) {
+	t.Log("Given the need to report the errors of many Goroutines at once.")
+	{
+		t.Logf("\tTest 0:\tWhen nothing failed.")
+		{
+			var c errors.Collector
+			c.Add(nil)
+			if err := c.Err(); err != nil {
+				t.Fatalf("\t%s\tShould return a nil error : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould return a nil error.", succeed)
+		}
+
+		t.Logf("\tTest 1:\tWhen 100 Goroutines fail.")
+		{
+			var c errors.Collector
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					if i == 42 {
+						c.Add(errors.Wrap(&AppError{i}, "insert"))
+						return
+					}
+					c.Add(errors.Wrapf(io.EOF, "insert %d", i))
+				}(i)
+			}
+			wg.Wait()
+
+			err := c.Err()
+			if m, ok := err.(errors.MultiError); !ok || len(m) != 100 {
+				t.Fatalf("\t%s\tShould collect 100 errors : %v", failed, err)
+			}
+			t.Logf("\t%s\tShould collect 100 errors.", succeed)
+
+			if !errors.Is(err, io.EOF) {
+				t.Fatalf("\t%s\tShould match io.EOF with Is.", failed)
+			}
+			t.Logf("\t%s\tShould match io.EOF with Is.", succeed)
+
+			var app *AppError
+			if !errors.As(err, &app) || app.State != 42 {
+				t.Fatalf("\t%s\tShould find the *AppError with As.", failed)
+			}
+			t.Logf("\t%s\tShould find the *AppError with As.", succeed)
+
+			if got := err.Error(); !strings.HasPrefix(got, "100 errors occurred:\n\t* ") {
+				t.Fatalf("\t%s\tShould list every error : %q", failed, got)
+			}
+			t.Logf("\t%s\tShould list every error.", succeed)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Layer is a single error of a chain, as it is written in JSON.
+type Layer struct {
+	Message string     `json:"message"`
+	Op      string     `json:"op,omitempty"`
+	Type    string     `json:"type,omitempty"`
+	Frames  []Location `json:"frames,omitempty"`
+}
+
+// Layers returns every error in the chain of err, from the outermost to the cause.
+// An error of this package gives its own message, any other error gives all of Error. Errors of
+// this package that only carry a stack are merged into the layer below them.
+func Layers(err error, t Trim) []Layer {
+	var layers []Layer
+	var frames []Location
+
+	for err != nil {
+		l := Layer{
+			Message: err.Error(),
+			Type:    fmt.Sprintf("%T", err),
+		}
+
+		switch e := err.(type) {
+		case *withStack:
+			frames = t.Locations(e.StackTrace())
+			err = e.error
+			continue
+
+		case *wrapped:
+			l.Message = e.msg
+			l.Op = e.op
+			l.Type = ""
+		}
+
+		if st, ok := err.(interface{ StackTrace() StackTrace }); ok {
+			l.Frames = t.Locations(st.StackTrace())
+		}
+
+		// A stack from a withStack above belongs to this error, unless it has its own.
+		if l.Frames == nil {
+			l.Frames = frames
+		}
+		frames = nil
+
+		layers = append(layers, l)
+		err = Unwrap(err)
+	}
+
+	return layers
+}
+
+// JSON returns err as a JSON document for a log pipeline:
+//   {
+//     "error": "firstCall: App Error, State: 99",
+//     "op": "firstCall",
+//     "layers": [
+//       {"message": "firstCall", "op": "firstCall", "frames": [{"function": "main.firstCall", ...}]},
+//       {"message": "App Error, State: 99", "type": "*main.AppError"}
+//     ]
+//   }
+func JSON(err error, t Trim) ([]byte, error) {
+	doc := struct {
+		Error  string  `json:"error"`
+		Op     string  `json:"op,omitempty"`
+		Layers []Layer `json:"layers"`
+	}{
+		Error:  err.Error(),
+		Op:     Op(err),
+		Layers: Layers(err, t),
+	}
+
+	// Messages like "firstCall->secondCall(10)" are kept readable, they are not going to a browser.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
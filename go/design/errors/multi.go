@@ -0,0 +1,99 @@
+package errors
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MultiError is a list of errors that is an error itself.
+// Is and As look at every error in the list, so a caller can ask about any of them without
+// walking the list.
+type MultiError []error
+
+// Error implements the error interface.
+// A single error is printed as it is. More than one is printed as a list, one error per line.
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return "no errors"
+	case 1:
+		return m[0].Error()
+	}
+
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(len(m)))
+	b.WriteString(" errors occurred:")
+	for _, err := range m {
+		b.WriteString("\n\t* ")
+		b.WriteString(err.Error())
+	}
+
+	return b.String()
+}
+
+// Is reports whether any error in the list matches target.
+func (m MultiError) Is(target error) bool {
+	for _, err := range m {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error in the list that matches target, and if so, sets target to that error
+// value and returns true.
+func (m MultiError) As(target interface{}) bool {
+	for _, err := range m {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Collector gathers errors from any number of Goroutines. The zero value is ready to use.
+type Collector struct {
+	mu   sync.Mutex
+	errs MultiError
+}
+
+// Add records err. A nil error is ignored, so the result of a call can be added without checking
+// it first.
+func (c *Collector) Add(err error) {
+	if err == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.errs = append(c.errs, err)
+}
+
+// Len returns the number of errors collected so far.
+func (c *Collector) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.errs)
+}
+
+// Err returns a MultiError with the errors collected so far, in the order they were added. It
+// returns nil when there are none.
+// Returning a nil MultiError instead would give the caller an error interface value that is not
+// nil. This is the same bug we look at in error_5.go.
+func (c *Collector) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.errs) == 0 {
+		return nil
+	}
+
+	return append(MultiError(nil), c.errs...)
+}
@@ -0,0 +1,221 @@
+package errors
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Frame is a single program counter of a stack trace.
+type Frame uintptr
+
+// pc returns the program counter of the call. The stored value is the return address, which is the
+// instruction after the call.
+func (f Frame) pc() uintptr {
+	return uintptr(f) - 1
+}
+
+// file returns the full path of the file of the call.
+func (f Frame) file() string {
+	fn := runtime.FuncForPC(f.pc())
+	if fn == nil {
+		return "unknown"
+	}
+
+	file, _ := fn.FileLine(f.pc())
+	return file
+}
+
+// line returns the line of the call.
+func (f Frame) line() int {
+	fn := runtime.FuncForPC(f.pc())
+	if fn == nil {
+		return 0
+	}
+
+	_, line := fn.FileLine(f.pc())
+	return line
+}
+
+// name returns the full name of the function of the call.
+func (f Frame) name() string {
+	fn := runtime.FuncForPC(f.pc())
+	if fn == nil {
+		return "unknown"
+	}
+
+	return fn.Name()
+}
+
+// Format implements the fmt.Formatter interface, in the same way github.com/pkg/errors does:
+//   %s    file name
+//   %d    line number
+//   %n    function name
+//   %v    file:line
+//   %+s   function name and full path of the file, on two lines
+//   %+v   function name and full path of the file:line, on two lines
+func (f Frame) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 's':
+		if s.Flag('+') {
+			io.WriteString(s, f.name())
+			io.WriteString(s, "\n\t")
+			io.WriteString(s, f.file())
+			return
+		}
+		io.WriteString(s, path.Base(f.file()))
+	case 'd':
+		io.WriteString(s, strconv.Itoa(f.line()))
+	case 'n':
+		io.WriteString(s, funcname(f.name()))
+	case 'v':
+		f.Format(s, 's')
+		io.WriteString(s, ":")
+		f.Format(s, 'd')
+	}
+}
+
+// funcname removes the path of the package from a function name.
+func funcname(name string) string {
+	i := strings.LastIndex(name, "/")
+	name = name[i+1:]
+	i = strings.Index(name, ".")
+	return name[i+1:]
+}
+
+// StackTrace is a stack of frames, from the innermost call to the outermost.
+type StackTrace []Frame
+
+// Format implements the fmt.Formatter interface.
+// %+v prints every frame on its own lines, %v and %s print them as a list.
+func (st StackTrace) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			for _, f := range st {
+				io.WriteString(s, "\n")
+				f.Format(s, verb)
+			}
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, "[")
+		for i, f := range st {
+			if i > 0 {
+				io.WriteString(s, " ")
+			}
+			f.Format(s, verb)
+		}
+		io.WriteString(s, "]")
+	}
+}
+
+// stack is the program counters of a stack trace.
+type stack []uintptr
+
+// Format prints the stack for %+v and nothing for every other verb.
+func (s *stack) Format(st fmt.State, verb rune) {
+	if verb == 'v' && st.Flag('+') {
+		for _, pc := range *s {
+			fmt.Fprintf(st, "\n%+v", Frame(pc))
+		}
+	}
+}
+
+// StackTrace returns the frames of the stack.
+// Every error created by this package has this method.
+func (s *stack) StackTrace() StackTrace {
+	st := make(StackTrace, len(*s))
+	for i, pc := range *s {
+		st[i] = Frame(pc)
+	}
+	return st
+}
+
+// callers records the stack of the caller of the function that called it.
+func callers() *stack {
+	const depth = 32
+
+	var pcs [depth]uintptr
+	n := runtime.Callers(3, pcs[:])
+
+	var st stack = pcs[:n]
+	return &st
+}
+
+// Location is where a frame is in the source code.
+type Location struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// Trim decides how much of a stack trace is kept when it is turned into locations.
+type Trim struct {
+	Prefixes []string // removed from the start of every file path, the first match wins
+	Runtime  bool     // drop the frames of the runtime package, like runtime.main and runtime.goexit
+}
+
+// DefaultTrim drops the runtime frames and removes the GOROOT, GOPATH and module cache prefixes, so
+// a file is shown as net/http/server.go or github.com/user/repo/file.go.
+func DefaultTrim() Trim {
+	prefixes := []string{filepath.Join(build.Default.GOROOT, "src") + string(filepath.Separator)}
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		prefixes = append(prefixes,
+			filepath.Join(p, "pkg", "mod")+string(filepath.Separator),
+			filepath.Join(p, "src")+string(filepath.Separator),
+		)
+	}
+
+	return Trim{
+		Prefixes: prefixes,
+		Runtime:  true,
+	}
+}
+
+// Locations resolves the frames of st into locations. Calls that were inlined by the compiler are
+// expanded into their own locations.
+func (t Trim) Locations(st StackTrace) []Location {
+	if len(st) == 0 {
+		return nil
+	}
+
+	pcs := make([]uintptr, len(st))
+	for i, f := range st {
+		pcs[i] = uintptr(f)
+	}
+
+	var locs []Location
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !(t.Runtime && strings.HasPrefix(f.Function, "runtime.")) {
+			locs = append(locs, Location{
+				Function: f.Function,
+				File:     t.file(f.File),
+				Line:     f.Line,
+			})
+		}
+
+		if !more {
+			return locs
+		}
+	}
+}
+
+// file removes the first matching prefix from a file path.
+func (t Trim) file(file string) string {
+	for _, p := range t.Prefixes {
+		if p != "" && strings.HasPrefix(file, filepath.ToSlash(p)) {
+			return file[len(p):]
+		}
+	}
+
+	return file
+}
@@ -0,0 +1,27 @@
+// -----------
+// errptr tool
+// -----------
+
+// errptr finds the bug in design/error_5.go: a concrete error type returned by a function and
+// stored in an error interface.
+
+// The analyzer is its own module since golang.org/x/tools needs a much newer Go than the rest of
+// the repository. Build it from go/design/errptr:
+//   go build -o /tmp/errptr ./cmd/errptr
+
+// It runs on its own:
+//   /tmp/errptr ../error_5.go
+// or as part of go vet, from anywhere in the repository:
+//   go vet -vettool=/tmp/errptr ./go/design/...
+// Add -funcs=false to only report the call sites.
+
+package main
+
+import (
+	"github.com/hoanhan101/ultimate-go/go/design/errptr"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(errptr.Analyzer)
+}
@@ -0,0 +1,239 @@
+// Package errptr defines an Analyzer that finds the bug in design/error_5.go.
+//
+// A function that returns a concrete error type, like *customError, returns a nil pointer when
+// nothing failed. Once that nil pointer is assigned to a variable of the error interface type, the
+// interface is not nil anymore. It has a type, and only its value is nil:
+//   var err error
+//   if _, err = fail(); err != nil {   // always true
+//
+// The Analyzer reports two things:
+// - functions whose last result is a concrete type that implements error, because that is where
+// the bug comes from. This can be turned off with -funcs=false.
+// - call sites that assign the result of such a function to an interface. This is the bug itself:
+// assignments, variable declarations and return statements are checked. Only types that can be
+// nil are reported there: pointers, slices, maps, channels and functions. A struct can't be nil,
+// so it never turns into a non nil interface by surprise. Conversions and built in functions like
+// append are not function calls we can fix, so they are left alone.
+package errptr
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// Analyzer reports concrete error types that are returned where an error interface is expected.
+var Analyzer = &analysis.Analyzer{
+	Name:     "errptr",
+	Doc:      "report concrete error types returned by functions and assigned to error interfaces",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// funcs tells if function declarations are reported, and not only the call sites.
+var funcs bool
+
+func init() {
+	Analyzer.Flags.BoolVar(&funcs, "funcs", true, "report functions that return a concrete error type")
+}
+
+// errorType is the error interface.
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// isConcreteError reports whether t is a concrete type that implements error.
+func isConcreteError(t types.Type) bool {
+	if t == nil || types.IsInterface(t) {
+		return false
+	}
+
+	return types.Implements(t, errorType)
+}
+
+// isNilable reports whether a value of t can be nil.
+func isNilable(t types.Type) bool {
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature:
+		return true
+	}
+
+	return false
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodes := []ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.AssignStmt)(nil),
+		(*ast.ValueSpec)(nil),
+		(*ast.ReturnStmt)(nil),
+	}
+
+	insp.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if funcs {
+				checkFunc(pass, n.Name.Name, n.Type)
+			}
+
+		case *ast.AssignStmt:
+			lhs := make([]types.Type, len(n.Lhs))
+			for i, e := range n.Lhs {
+				lhs[i] = pass.TypesInfo.TypeOf(e)
+			}
+			checkAssign(pass, lhs, n.Rhs)
+
+		case *ast.ValueSpec:
+			if n.Type == nil {
+				return true
+			}
+
+			t := pass.TypesInfo.TypeOf(n.Type)
+			lhs := make([]types.Type, len(n.Names))
+			for i := range lhs {
+				lhs[i] = t
+			}
+			checkAssign(pass, lhs, n.Values)
+
+		case *ast.ReturnStmt:
+			sig := enclosing(pass, stack)
+			if sig == nil {
+				return true
+			}
+
+			lhs := make([]types.Type, sig.Results().Len())
+			for i := range lhs {
+				lhs[i] = sig.Results().At(i).Type()
+			}
+			checkAssign(pass, lhs, n.Results)
+		}
+
+		return true
+	})
+
+	return nil, nil
+}
+
+// checkFunc reports a function whose last result is a concrete error type.
+func checkFunc(pass *analysis.Pass, name string, ft *ast.FuncType) {
+	if ft.Results == nil || len(ft.Results.List) == 0 {
+		return
+	}
+
+	last := ft.Results.List[len(ft.Results.List)-1]
+	t := pass.TypesInfo.TypeOf(last.Type)
+	if !isConcreteError(t) {
+		return
+	}
+
+	pass.Reportf(last.Type.Pos(), "%s returns concrete error type %s instead of error", name, typeString(pass, t))
+}
+
+// checkAssign reports the calls on the right side whose concrete error results are stored into an
+// interface on the left side. Both sides line up one to one, or a single call returns every value.
+func checkAssign(pass *analysis.Pass, lhs []types.Type, rhs []ast.Expr) {
+	results := func(call *ast.CallExpr) []types.Type {
+		if tv, ok := pass.TypesInfo.Types[unparen(call.Fun)]; !ok || tv.IsType() || tv.IsBuiltin() {
+			return nil
+		}
+
+		switch t := pass.TypesInfo.TypeOf(call).(type) {
+		case *types.Tuple:
+			ts := make([]types.Type, t.Len())
+			for i := range ts {
+				ts[i] = t.At(i).Type()
+			}
+			return ts
+		case nil:
+			return nil
+		default:
+			return []types.Type{t}
+		}
+	}
+
+	check := func(to types.Type, from types.Type, call *ast.CallExpr) {
+		if to == nil || !types.IsInterface(to) || !isConcreteError(from) || !isNilable(from) {
+			return
+		}
+
+		pass.Reportf(call.Pos(), "%s returns concrete error type %s, a nil %s stored in %s is not nil",
+			callee(call), typeString(pass, from), typeString(pass, from), typeString(pass, to))
+	}
+
+	if len(rhs) == 1 && len(lhs) > 1 {
+		call, ok := unparen(rhs[0]).(*ast.CallExpr)
+		if !ok {
+			return
+		}
+
+		ts := results(call)
+		for i := 0; i < len(lhs) && i < len(ts); i++ {
+			check(lhs[i], ts[i], call)
+		}
+		return
+	}
+
+	for i := 0; i < len(lhs) && i < len(rhs); i++ {
+		call, ok := unparen(rhs[i]).(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+
+		if ts := results(call); len(ts) == 1 {
+			check(lhs[i], ts[0], call)
+		}
+	}
+}
+
+// enclosing returns the signature of the innermost function on the stack.
+func enclosing(pass *analysis.Pass, stack []ast.Node) *types.Signature {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch fn := stack[i].(type) {
+		case *ast.FuncDecl:
+			if obj, ok := pass.TypesInfo.Defs[fn.Name].(*types.Func); ok {
+				return obj.Type().(*types.Signature)
+			}
+			return nil
+		case *ast.FuncLit:
+			sig, _ := pass.TypesInfo.TypeOf(fn).(*types.Signature)
+			return sig
+		}
+	}
+
+	return nil
+}
+
+// unparen returns e with any enclosing parentheses removed.
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// callee returns the name of the function being called, as it is written.
+func callee(call *ast.CallExpr) string {
+	switch fn := unparen(call.Fun).(type) {
+	case *ast.Ident:
+		return fn.Name
+	case *ast.SelectorExpr:
+		return fn.Sel.Name
+	}
+
+	return "call"
+}
+
+// typeString prints t relative to the package being checked.
+func typeString(pass *analysis.Pass, t types.Type) string {
+	return types.TypeString(t, types.RelativeTo(pass.Pkg))
+}
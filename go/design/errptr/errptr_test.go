@@ -0,0 +1,14 @@
+package errptr_test
+
+import (
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/design/errptr"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+// TestAnalyzer runs the Analyzer on testdata/src/a. Every line that should be reported has a
+// "want" comment with the expected message.
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), errptr.Analyzer, "a")
+}
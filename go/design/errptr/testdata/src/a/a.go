@@ -0,0 +1,103 @@
+package a
+
+import "errors"
+
+// customError is just an empty struct.
+type customError struct{}
+
+// Error implements the error interface.
+func (c *customError) Error() string {
+	return "Find the bug."
+}
+
+// valueError implements the error interface with a value receiver.
+type valueError struct{}
+
+func (valueError) Error() string {
+	return "value"
+}
+
+func fail() ([]byte, *customError) { // want `fail returns concrete error type \*customError instead of error`
+	return nil, nil
+}
+
+func newErr() *customError { // want `newErr returns concrete error type \*customError instead of error`
+	return nil
+}
+
+func value() valueError { // want `value returns concrete error type valueError instead of error`
+	return valueError{}
+}
+
+func good() ([]byte, error) {
+	return nil, nil
+}
+
+func assign() {
+	var err error
+
+	if _, err = fail(); err != nil { // want `fail returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+		return
+	}
+
+	err = newErr()   // want `newErr returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+	err = (newErr()) // want `newErr returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+	err = multi()    // want `multi returns concrete error type multiError, a nil multiError stored in error is not nil`
+
+	// A struct can't be nil, so storing it in an interface is not the bug.
+	err = value()
+	_ = err
+
+	// Storing the result in a variable of the concrete type is fine.
+	_, ce := fail()
+	_ = ce
+
+	_, err = good()
+	err = errors.New("ok")
+	_ = err
+}
+
+func declare() {
+	var err error = newErr() // want `newErr returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+	_ = err
+
+	var ce = newErr()
+	_ = ce
+}
+
+func ret() error {
+	return newErr() // want `newErr returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+}
+
+func retMulti() ([]byte, error) {
+	return fail() // want `fail returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+}
+
+func retLit() {
+	f := func() error {
+		return newErr() // want `newErr returns concrete error type \*customError, a nil \*customError stored in error is not nil`
+	}
+	_ = f
+}
+
+func retConcrete() *customError { // want `retConcrete returns concrete error type \*customError instead of error`
+	return newErr()
+}
+
+// multiError is a slice type that implements the error interface.
+type multiError []error
+
+func (m multiError) Error() string {
+	return "multi"
+}
+
+func multi() multiError { // want `multi returns concrete error type multiError instead of error`
+	return nil
+}
+
+func builtins(errs []error) error {
+	var err error = multiError(errs) // Conversions are not calls to a function.
+	_ = err
+
+	return append(multiError(nil), errs...) // Neither are built in functions.
+}
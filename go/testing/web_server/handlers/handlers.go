@@ -4,13 +4,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 )
 
 // Routes sets the routes for the web service.
 // It has 1 route call sendjson. When that route is executed, it will call the SendJSON function.
+// The user and json routes return their errors through the Errors registry instead of writing them.
 func Routes() {
 	http.HandleFunc("/sendjson", SendJSON)
+	http.Handle("/user", Handler(GetUser))
+	http.Handle("/json", Handler(MovedJSON))
 }
 
 // SendJSON returns a simple JSON document.
@@ -30,3 +35,42 @@ func SendJSON(rw http.ResponseWriter, r *http.Request) {
 	rw.WriteHeader(200)
 	json.NewEncoder(rw).Encode(&u)
 }
+
+// GetUser returns the user with the id in the query string.
+// It doesn't write its errors. It wraps them with what went wrong and returns them, the Errors
+// registry still finds the error variable inside and picks the status code.
+func GetUser(rw http.ResponseWriter, r *http.Request) error {
+	s := r.URL.Query().Get("id")
+	if s == "" {
+		return fmt.Errorf("missing id: %w", ErrBadRequest)
+	}
+
+	id, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("id %q is not a number: %w", s, ErrBadRequest)
+	}
+
+	if id != 1 {
+		return fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+
+	u := struct {
+		ID    int
+		Name  string
+		Email string
+	}{
+		ID:    id,
+		Name:  "Hoanh An",
+		Email: "hoanhan101@gmail.com",
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(200)
+	json.NewEncoder(rw).Encode(&u)
+	return nil
+}
+
+// MovedJSON is where SendJSON used to be.
+func MovedJSON(rw http.ResponseWriter, r *http.Request) error {
+	return &MovedError{URL: "/sendjson"}
+}
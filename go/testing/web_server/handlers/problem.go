@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// These are the error variables from design/error_2.go. Handlers return them, wrapped with more
+// context if they want to, and the registry below decides what the client gets to see.
+var (
+	// ErrBadRequest is returned when there are problems with the request.
+	ErrBadRequest = errors.New("Bad Request")
+
+	// ErrPageMoved is returned when a 301/302 is returned.
+	ErrPageMoved = errors.New("Page Moved")
+
+	// ErrNotFound is returned when the resource doesn't exist.
+	ErrNotFound = errors.New("Not Found")
+)
+
+// MovedError is an ErrPageMoved that knows where the page went.
+type MovedError struct {
+	URL string
+}
+
+// MovedError implements the error interface.
+func (e *MovedError) Error() string {
+	return "Page Moved to " + e.URL
+}
+
+// Is makes errors.Is(err, ErrPageMoved) true for a *MovedError.
+func (e *MovedError) Is(target error) bool {
+	return target == ErrPageMoved
+}
+
+// Location returns the new URL of the page. The registry sets it as the Location header.
+func (e *MovedError) Location() string {
+	return e.URL
+}
+
+// Problem is the body of an error response as defined by RFC 7807.
+// https://tools.ietf.org/html/rfc7807
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// rule is a single entry in the registry.
+type rule struct {
+	match  func(err error) bool
+	status int
+}
+
+// Registry maps errors to HTTP status codes. The first rule that matches an error wins, so the
+// more specific errors have to be registered first.
+type Registry struct {
+	mu    sync.RWMutex
+	rules []rule
+}
+
+// Register maps every error that errors.Is matches with target to the status code.
+func (reg *Registry) Register(target error, status int) {
+	reg.add(rule{
+		match: func(err error) bool {
+			return errors.Is(err, target)
+		},
+		status: status,
+	})
+}
+
+// RegisterAs maps every error that errors.As can store into target to the status code. Just like
+// with errors.As, target is a pointer to a variable of the error type:
+//   var ve *ValidationError
+//   reg.RegisterAs(&ve, http.StatusUnprocessableEntity)
+// Only the type of target is used, a new variable is created for every match.
+func (reg *Registry) RegisterAs(target interface{}, status int) {
+	t := reflect.TypeOf(target)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic("handlers: RegisterAs target must be a non-nil pointer")
+	}
+
+	reg.add(rule{
+		match: func(err error) bool {
+			return errors.As(err, reflect.New(t.Elem()).Interface())
+		},
+		status: status,
+	})
+}
+
+// add appends a rule.
+func (reg *Registry) add(r rule) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	reg.rules = append(reg.rules, r)
+}
+
+// Status returns the status code for err, 500 if no rule matches.
+func (reg *Registry) Status(err error) int {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+
+	for _, r := range reg.rules {
+		if r.match(err) {
+			return r.status
+		}
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Problem returns the problem details for err on the request r.
+// The detail of an error we don't know about is not shown. It may have things in it the client
+// has no business seeing, it belongs in the log.
+func (reg *Registry) Problem(r *http.Request, err error) Problem {
+	status := reg.Status(err)
+
+	p := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Instance: r.URL.Path,
+	}
+
+	if status < http.StatusInternalServerError {
+		p.Detail = err.Error()
+	}
+
+	return p
+}
+
+// Error writes err as an application/problem+json response.
+func (reg *Registry) Error(w http.ResponseWriter, r *http.Request, err error) {
+	p := reg.Problem(r, err)
+
+	var l interface{ Location() string }
+	if errors.As(err, &l) {
+		w.Header().Set("Location", l.Location())
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(&p)
+}
+
+// Errors is the registry the handlers of this package use.
+var Errors Registry
+
+func init() {
+	Errors.Register(ErrBadRequest, http.StatusBadRequest)
+	Errors.Register(ErrPageMoved, http.StatusMovedPermanently)
+	Errors.Register(ErrNotFound, http.StatusNotFound)
+}
+
+// Handler is a handler that returns an error instead of writing it.
+// The error is turned into a response by the Errors registry.
+type Handler func(rw http.ResponseWriter, r *http.Request) error
+
+// ServeHTTP implements the http.Handler interface.
+func (h Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if err := h(rw, r); err != nil {
+		Errors.Error(rw, r, err)
+	}
+}
@@ -0,0 +1,123 @@
+// -------------
+// Problem tests
+// -------------
+
+// Below is how to test that the errors returned by the handlers turn into the right problem
+// details, without having to stand up the server.
+
+// Run test using "go test -run TestProblem"
+
+package handlers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hoanhan101/ultimate-go/go/testing/web_server/handlers"
+)
+
+// TestProblem tests the routes that return errors through the registry.
+func TestProblem(t *testing.T) {
+	tests := []struct {
+		url      string
+		status   int
+		location string
+	}{
+		{"/user", http.StatusBadRequest, ""},
+		{"/user?id=bill", http.StatusBadRequest, ""},
+		{"/user?id=2", http.StatusNotFound, ""},
+		{"/json", http.StatusMovedPermanently, "/sendjson"},
+	}
+
+	t.Log("Given the need to test the problem details of the endpoints.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen checking %q for status code %d", i, tt.url, tt.status)
+			{
+				r := httptest.NewRequest("GET", tt.url, nil)
+				w := httptest.NewRecorder()
+				http.DefaultServeMux.ServeHTTP(w, r)
+
+				if w.Code != tt.status {
+					t.Fatalf("\t%s\tShould receive a status code of %d for the response. Received[%d].", failed, tt.status, w.Code)
+				}
+				t.Logf("\t%s\tShould receive a status code of %d for the response.", succeed, tt.status)
+
+				if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+					t.Fatalf("\t%s\tShould receive an application/problem+json response : %q", failed, ct)
+				}
+				t.Logf("\t%s\tShould receive an application/problem+json response.", succeed)
+
+				var p handlers.Problem
+				if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+					t.Fatalf("\t%s\tShould be able to decode the response.", failed)
+				}
+				t.Logf("\t%s\tShould be able to decode the response.", succeed)
+
+				if p.Status != tt.status || p.Title != http.StatusText(tt.status) || p.Detail == "" {
+					t.Fatalf("\t%s\tShould have the status, the title and the detail in the response : %+v", failed, p)
+				}
+				t.Logf("\t%s\tShould have the status, the title and the detail in the response.", succeed)
+
+				if l := w.Header().Get("Location"); l != tt.location {
+					t.Fatalf("\t%s\tShould have %q for Location : %q", failed, tt.location, l)
+				}
+				t.Logf("\t%s\tShould have %q for Location.", succeed, tt.location)
+			}
+		}
+	}
+}
+
+// ValidationError is a custom error type for the RegisterAs test.
+type ValidationError struct {
+	Field string
+}
+
+// ValidationError implements the error interface.
+func (e *ValidationError) Error() string {
+	return "invalid " + e.Field
+}
+
+// TestRegistry tests how errors are matched against the rules.
+func TestRegistry(t *testing.T) {
+	var reg handlers.Registry
+	reg.Register(handlers.ErrBadRequest, http.StatusBadRequest)
+
+	var ve *ValidationError
+	reg.RegisterAs(&ve, http.StatusUnprocessableEntity)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"error variable", handlers.ErrBadRequest, http.StatusBadRequest},
+		{"wrapped error variable", fmt.Errorf("decode: %w", handlers.ErrBadRequest), http.StatusBadRequest},
+		{"wrapped error type", fmt.Errorf("decode: %w", &ValidationError{"email"}), http.StatusUnprocessableEntity},
+		{"unknown error", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+
+	t.Log("Given the need to map errors to status codes.")
+	{
+		for i, tt := range tests {
+			t.Logf("\tTest %d:\tWhen the handler returns an %s.", i, tt.name)
+			{
+				r := httptest.NewRequest("GET", "/", nil)
+				p := reg.Problem(r, tt.err)
+
+				if p.Status != tt.status {
+					t.Fatalf("\t%s\tShould map to %d. Received[%d].", failed, tt.status, p.Status)
+				}
+				t.Logf("\t%s\tShould map to %d.", succeed, tt.status)
+
+				if tt.status >= 500 && p.Detail != "" {
+					t.Fatalf("\t%s\tShould not show the detail of an unknown error : %q", failed, p.Detail)
+				}
+			}
+		}
+	}
+}